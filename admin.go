@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// configDiff summarises what a reload changed
+type configDiff struct {
+	RedirectsAdded   []string `json:"redirects_added,omitempty"`
+	RedirectsRemoved []string `json:"redirects_removed,omitempty"`
+	RedirectsChanged []string `json:"redirects_changed,omitempty"`
+	RewritesAdded    []string `json:"rewrites_added,omitempty"`
+	RewritesRemoved  []string `json:"rewrites_removed,omitempty"`
+	RewritesChanged  []string `json:"rewrites_changed,omitempty"`
+	HeadersChanged   []string `json:"headers_changed,omitempty"` // headers.toml sections, e.g. "cache"
+}
+
+// empty reports whether the diff contains no changes
+func (d configDiff) empty() bool {
+	return len(d.RedirectsAdded)+len(d.RedirectsRemoved)+len(d.RedirectsChanged)+
+		len(d.RewritesAdded)+len(d.RewritesRemoved)+len(d.RewritesChanged)+
+		len(d.HeadersChanged) == 0
+}
+
+// diffRules returns the sorted keys added to, removed from and changed between two rule maps
+func diffRules[V comparable](before, after map[string]V) (added, removed, changed []string) {
+	for key, value := range after {
+		previous, ok := before[key]
+		switch {
+		case !ok:
+			added = append(added, key)
+		case previous != value:
+			changed = append(changed, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// diffHeaders returns the headers.toml sections that differ between two configurations
+func diffHeaders(before, after *HeaderConfig) []string {
+	if before == nil {
+		before = &HeaderConfig{}
+	}
+	if after == nil {
+		after = &HeaderConfig{}
+	}
+
+	var changed []string
+	b, a := reflect.ValueOf(before).Elem(), reflect.ValueOf(after).Elem()
+	for i := 0; i < b.NumField(); i++ {
+		if !reflect.DeepEqual(b.Field(i).Interface(), a.Field(i).Interface()) {
+			name, _, _ := strings.Cut(b.Type().Field(i).Tag.Get("toml"), ",")
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// diffSiteConfig compares the configuration before and after a reload
+func diffSiteConfig(before, after *siteConfig) configDiff {
+	var diff configDiff
+	diff.RedirectsAdded, diff.RedirectsRemoved, diff.RedirectsChanged = diffRules(before.redirects, after.redirects)
+	diff.RewritesAdded, diff.RewritesRemoved, diff.RewritesChanged = diffRules(before.rewriteRules, after.rewriteRules)
+	diff.HeadersChanged = diffHeaders(before.headers, after.headers)
+	return diff
+}
+
+// reloadReport describes the outcome of reloading one site
+type reloadReport struct {
+	Host     string     `json:"host,omitempty"`
+	Bucket   string     `json:"bucket"`
+	Changed  bool       `json:"changed"`
+	Diff     configDiff `json:"diff"`
+	LoadedAt time.Time  `json:"loaded_at"` // when the configuration in effect was loaded
+	Warnings []string   `json:"warnings,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// reloadTarget is a site reloaded on demand
+type reloadTarget struct {
+	host   string // empty unless serving virtual hosts
+	server *gcsServer
+}
+
+// siteReloader reloads the configuration of every site served by the process
+type siteReloader struct {
+	targets []reloadTarget
+}
+
+// reload forces every site to load its configuration again and reports what changed.
+// It returns false when any site failed to load and kept its previous configuration.
+func (r *siteReloader) reload(ctx context.Context) ([]reloadReport, bool) {
+	reports := make([]reloadReport, 0, len(r.targets))
+	ok := true
+	for _, target := range r.targets {
+		report := reloadReport{Host: target.host, Bucket: target.server.bucketName}
+		previous, current, err := target.server.reloadConfig(ctx, true)
+		if err != nil {
+			ok = false
+			report.Error = err.Error()
+		}
+		if current != nil {
+			report.Diff = diffSiteConfig(previous, current)
+			report.Changed = !report.Diff.empty()
+			report.LoadedAt = current.loadedAt
+			report.Warnings = current.warnings
+		}
+		reports = append(reports, report)
+	}
+	return reports, ok
+}
+
+// requireAdminToken only passes requests carrying the admin token as a bearer token to next
+func requireAdminToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provided, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="spray admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminReloadHandler serves POST /admin/reload, which reloads the configuration of every
+// site and returns what changed. Requests must carry the admin token as a bearer token.
+func adminReloadHandler(reloader *siteReloader, token string) http.HandlerFunc {
+	reload := requireAdminToken(token, func(w http.ResponseWriter, r *http.Request) {
+		reports, ok := reloader.reload(r.Context())
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusInternalServerError
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(struct {
+			Sites []reloadReport `json:"sites"`
+		}{Sites: reports})
+	})
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		reload(w, r)
+	}
+}
+
+// watchReloadSignals reloads every site for each value received on signals, until ctx is cancelled
+func watchReloadSignals(ctx context.Context, signals <-chan os.Signal, reloader *siteReloader) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			reports, _ := reloader.reload(ctx)
+			for _, report := range reports {
+				summary, _ := json.Marshal(report)
+				log.Printf("Configuration reload after SIGHUP: %s", summary)
+			}
+		}
+	}
+}
+
+// stopOnShutdown returns a context for the background reloads of the sites srv serves,
+// which is cancelled when srv shuts down
+func stopOnShutdown(ctx context.Context, srv *http.Server) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	srv.RegisterOnShutdown(cancel)
+	return ctx
+}
+
+// serveReloads reloads every site on SIGHUP and, when an admin token is configured,
+// registers POST /admin/reload on mux. Signals are handled until ctx is cancelled.
+func serveReloads(ctx context.Context, mux *http.ServeMux, reloader *siteReloader, adminToken string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		watchReloadSignals(ctx, signals, reloader)
+	}()
+
+	if adminToken != "" {
+		mux.HandleFunc("/admin/reload", adminReloadHandler(reloader, adminToken))
+	}
+}
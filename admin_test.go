@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffSiteConfig(t *testing.T) {
+	before := &siteConfig{
+		redirects:    map[string]RedirectRule{"old": {To: "/a"}, "gone": {To: "/b"}, "same": {To: "/c"}},
+		rewriteRules: map[string]string{"app/*": "app/index.html"},
+		headers:      getDefaultHeaderConfig(),
+	}
+	afterHeaders := getDefaultHeaderConfig()
+	afterHeaders.Cache.Enabled = !afterHeaders.Cache.Enabled
+	afterHeaders.SPA.Enabled = true
+	after := &siteConfig{
+		redirects:    map[string]RedirectRule{"old": {To: "/a", Status: 301}, "same": {To: "/c"}, "new": {To: "/d"}},
+		rewriteRules: map[string]string{},
+		headers:      afterHeaders,
+	}
+
+	diff := diffSiteConfig(before, after)
+	assert.Equal(t, configDiff{
+		RedirectsAdded:   []string{"new"},
+		RedirectsRemoved: []string{"gone"},
+		RedirectsChanged: []string{"old"},
+		RewritesRemoved:  []string{"app/*"},
+		HeadersChanged:   []string{"cache", "spa"},
+	}, diff)
+	assert.False(t, diff.empty())
+	assert.True(t, diffSiteConfig(before, before).empty())
+	assert.Empty(t, diffHeaders(nil, &HeaderConfig{}))
+}
+
+func TestAdminReloadHandler(t *testing.T) {
+	server, root := newReloadableServer(t, "admin-reload-bucket", map[string]string{
+		".spray/redirects.toml": "[redirects]\n\"/old\" = \"/new\"\n",
+	})
+	handler := adminReloadHandler(&siteReloader{targets: []reloadTarget{{server: server}}}, "s3cret")
+
+	post := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	t.Run("requires post", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, "/admin/reload", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+
+	t.Run("requires the token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, post("").Code)
+		assert.Equal(t, http.StatusUnauthorized, post("Bearer wrong").Code)
+		assert.Equal(t, http.StatusUnauthorized, post("s3cret").Code)
+	})
+
+	t.Run("reloads and reports the diff", func(t *testing.T) {
+		writeTestFile(t, root, ".spray/redirects.toml", "[redirects]\n\"/old\" = \"/newer\"\n\"/extra\" = \"/x\"\n")
+
+		rr := post("Bearer s3cret")
+		require.Equal(t, http.StatusOK, rr.Code)
+		var body struct {
+			Sites []reloadReport `json:"sites"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+		require.Len(t, body.Sites, 1)
+		site := body.Sites[0]
+		assert.Equal(t, "admin-reload-bucket", site.Bucket)
+		assert.True(t, site.Changed)
+		assert.Equal(t, []string{"extra"}, site.Diff.RedirectsAdded)
+		assert.Equal(t, []string{"old"}, site.Diff.RedirectsChanged)
+		assert.Empty(t, site.Error)
+		assert.Equal(t, "/newer", redirectLocation(server, "/old"))
+	})
+
+	t.Run("unchanged configuration", func(t *testing.T) {
+		rr := post("Bearer s3cret")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"changed":false`)
+	})
+
+	t.Run("failures keep the previous configuration", func(t *testing.T) {
+		writeTestFile(t, root, ".spray/redirects.toml", "not toml [")
+		rr := post("Bearer s3cret")
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Contains(t, rr.Body.String(), "error parsing redirects file")
+		assert.Equal(t, "/newer", redirectLocation(server, "/old"))
+	})
+}
+
+func TestWatchReloadSignals(t *testing.T) {
+	server, root := newReloadableServer(t, "sighup-bucket", map[string]string{})
+	writeTestFile(t, root, ".spray/redirects.toml", "[redirects]\n\"/old\" = \"/signalled\"\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal)
+	done := make(chan struct{})
+	go func() {
+		watchReloadSignals(ctx, signals, &siteReloader{targets: []reloadTarget{{server: server}}})
+		close(done)
+	}()
+
+	// The unbuffered send returns once the watcher has taken the signal; the second
+	// send only completes after the first reload finished
+	signals <- syscall.SIGHUP
+	signals <- syscall.SIGHUP
+	assert.Equal(t, "/signalled", redirectLocation(server, "/old"))
+
+	cancel()
+	<-done
+}
+
+func TestStopOnShutdown(t *testing.T) {
+	srv := &http.Server{}
+	ctx := stopOnShutdown(context.Background(), srv)
+	require.NoError(t, ctx.Err())
+
+	require.NoError(t, srv.Shutdown(context.Background()))
+	assert.Eventually(t, func() bool { return ctx.Err() != nil }, time.Second, 5*time.Millisecond, "background reloads stop with the server")
+}
+
+func TestCreateServer_AdminReload(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "index.html", "home")
+	store, err := newFileObjectStore(root)
+	require.NoError(t, err)
+
+	serve := func(cfg *config) int {
+		srv, err := createServer(t.Context(), cfg, newMockLogClient())
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	base := config{port: "8080", bucketName: "admin-bucket", store: store, redirects: map[string]RedirectRule{}, headers: getDefaultHeaderConfig()}
+	withToken := base
+	withToken.adminToken = "token"
+	assert.Equal(t, http.StatusOK, serve(&withToken))
+	assert.Equal(t, http.StatusNotFound, serve(&base), "the endpoint is disabled without a token")
+}
+
+func TestLoadConfig_AdminToken(t *testing.T) {
+	t.Setenv("BUCKET_NAME", "test-bucket")
+	t.Setenv("GOOGLE_PROJECT_ID", "test-project")
+	t.Setenv("SPRAY_ADMIN_TOKEN", "from-env")
+	cfg, err := loadConfig(context.Background(), &config{port: "8080"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", cfg.adminToken)
+}
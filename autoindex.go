@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/storage"
+)
+
+const (
+	// defaultAutoindexPageSize is the number of entries per listing page when none is configured
+	defaultAutoindexPageSize = 100
+	// maxAutoindexPageSize bounds page_size so one request cannot list a whole bucket
+	maxAutoindexPageSize = 1000
+	// autoindexPageParam is the query parameter carrying the listing page token
+	autoindexPageParam = "page"
+)
+
+// AutoindexConfig controls generated listings for directories that have no index.html
+type AutoindexConfig struct {
+	Enabled  bool     `toml:"enabled" json:"enabled"`
+	Prefixes []string `toml:"prefixes" json:"prefixes"`   // request path prefixes that are listed; "/" lists the whole site
+	PageSize int      `toml:"page_size" json:"page_size"` // entries per page, default: 100, max: 1000
+}
+
+// autoindexEntry is a file or subdirectory in a directory listing
+type autoindexEntry struct {
+	Name        string     `json:"name"`
+	Path        string     `json:"path"`
+	Type        string     `json:"type"` // file or directory
+	Size        int64      `json:"size"`
+	ContentType string     `json:"content_type,omitempty"`
+	Modified    *time.Time `json:"modified,omitempty"`
+}
+
+// autoindexListing is one page of a directory listing
+type autoindexListing struct {
+	Path     string           `json:"path"`
+	Entries  []autoindexEntry `json:"entries"`
+	NextPage string           `json:"next_page,omitempty"` // URL of the next page
+}
+
+// autoindexDirectory returns the object prefix to list for a directory request whose
+// index.html does not exist, or false when autoindex does not apply to it
+func (s *gcsServer) autoindexDirectory(r *http.Request, cleanPath string) (string, bool) {
+	if s.headers == nil || !s.headers.Autoindex.Enabled || len(s.headers.Autoindex.Prefixes) == 0 {
+		return "", false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "", false
+	}
+
+	// Only directory requests, which cleanRequestPath maps onto their index.html
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		return "", false
+	}
+	dir, ok := strings.CutSuffix(cleanPath, "index.html")
+	if !ok || (dir != "" && !strings.HasSuffix(dir, "/")) {
+		return "", false
+	}
+
+	if !spaPrefixMatches(strings.TrimSuffix(dir, "/"), s.headers.Autoindex.Prefixes) {
+		return "", false
+	}
+	return dir, true
+}
+
+// autoindexPageSize returns the configured page size, applying the default
+func (s *gcsServer) autoindexPageSize() int {
+	if size := s.headers.Autoindex.PageSize; size > 0 {
+		return size
+	}
+	return defaultAutoindexPageSize
+}
+
+// serveAutoindex writes a listing of the objects below dir, as HTML for browsers and
+// JSON for API clients
+func (s *gcsServer) serveAutoindex(w *responseWriter, r *http.Request, cleanPath, dir string, start time.Time) {
+	pageToken := r.URL.Query().Get(autoindexPageParam)
+
+	gcsStart := time.Now()
+	objects, next, err := s.store.ListObjects(r.Context(), dir, pageToken, s.autoindexPageSize())
+	gcsLatency.WithLabelValues(s.bucketName, "list_objects").Observe(time.Since(gcsStart).Seconds())
+	if err != nil {
+		s.sendStorageError(w, r, cleanPath, err)
+		return
+	}
+
+	// A prefix without any objects is not a directory
+	if len(objects) == 0 && pageToken == "" && dir != "" {
+		s.sendStorageError(w, r, cleanPath, storage.ErrObjectNotExist)
+		return
+	}
+
+	listing := autoindexListing{Path: "/" + dir, Entries: []autoindexEntry{}}
+	for _, attrs := range objects {
+		key := listEntryKey(attrs)
+		name := strings.TrimPrefix(key, dir)
+		// Objects that cannot be served are not listed either
+		if s.hiddenReason(key) != "" {
+			continue
+		}
+		entry := autoindexEntry{
+			Name: name,
+			Path: (&url.URL{Path: "/" + key}).EscapedPath(),
+			Type: "file",
+		}
+		if attrs.Prefix != "" {
+			entry.Type = "directory"
+		} else {
+			entry.Size = attrs.Size
+			entry.ContentType = attrs.ContentType
+			if !attrs.Updated.IsZero() {
+				modified := attrs.Updated.UTC()
+				entry.Modified = &modified
+			}
+		}
+		listing.Entries = append(listing.Entries, entry)
+	}
+	if next != "" {
+		listing.NextPage = r.URL.EscapedPath() + "?" + url.Values{autoindexPageParam: {next}}.Encode()
+	}
+
+	format := "json"
+	if prefersHTML(r) {
+		format = "html"
+	}
+	autoindexRequests.WithLabelValues(s.bucketName, format).Inc()
+	requestsTotal.WithLabelValues(s.bucketName, cleanPath, r.Method, "200").Inc()
+	s.logInfo("autoindex", cleanPath, map[string]any{
+		"entries":     len(listing.Entries),
+		"format":      format,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+
+	if format == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	// Listings change whenever objects do, so browsers must not reuse them unchecked
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if format == "html" {
+		err = autoindexTemplate.Execute(w, listing)
+	} else {
+		err = json.NewEncoder(w).Encode(listing)
+	}
+	if err != nil {
+		s.logError(logging.Warning, "autoindex", cleanPath, http.StatusOK, err)
+	}
+}
+
+// formatListingSize renders a byte count for the HTML listing
+func formatListingSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// autoindexTemplate renders the HTML listing; html/template escapes object names
+var autoindexTemplate = template.Must(template.New("autoindex").Funcs(template.FuncMap{
+	"size": formatListingSize,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Index of {{.Path}}</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; margin: 2rem; color: #333; }
+        table { border-collapse: collapse; }
+        th, td { text-align: left; padding: 0.25rem 1.5rem 0.25rem 0; }
+        td.size { text-align: right; }
+        a { color: #0366d6; text-decoration: none; }
+        a:hover { text-decoration: underline; }
+    </style>
+</head>
+<body>
+    <h1>Index of {{.Path}}</h1>
+    <table>
+        <tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{- if ne .Path "/"}}
+        <tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{- end}}
+{{- range .Entries}}
+        <tr><td><a href="{{.Path}}">{{.Name}}</a></td><td class="size">{{if eq .Type "file"}}{{size .Size}}{{end}}</td><td>{{with .Modified}}{{.Format "2006-01-02 15:04:05 UTC"}}{{end}}</td></tr>
+{{- end}}
+    </table>
+{{- with .NextPage}}
+    <p><a href="{{.}}">Next page</a></p>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListKeysAndPaginate(t *testing.T) {
+	keys := []string{"downloads/b.zip", "downloads/a.zip", "downloads/v1/x.zip", "downloads/v1/y.zip", "downloads/v2/x.zip", "other/c.zip"}
+	entries := listKeys(keys, "downloads/", func(key string) *storage.ObjectAttrs {
+		return &storage.ObjectAttrs{Name: key}
+	})
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, listEntryKey(entry))
+	}
+	assert.Equal(t, []string{"downloads/a.zip", "downloads/b.zip", "downloads/v1/", "downloads/v2/"}, names)
+	assert.Equal(t, "downloads/v1/", entries[2].Prefix)
+
+	page, next := paginateListing(entries, "", 3)
+	assert.Len(t, page, 3)
+	assert.Equal(t, "downloads/v1/", next)
+
+	page, next = paginateListing(entries, next, 3)
+	require.Len(t, page, 1)
+	assert.Equal(t, "downloads/v2/", page[0].Prefix)
+	assert.Empty(t, next)
+}
+
+func TestFormatListingSize(t *testing.T) {
+	assert.Equal(t, "0 B", formatListingSize(0))
+	assert.Equal(t, "1023 B", formatListingSize(1023))
+	assert.Equal(t, "1.5 KiB", formatListingSize(1536))
+	assert.Equal(t, "2.0 MiB", formatListingSize(2*1024*1024))
+}
+
+func TestServeHTTP_Autoindex(t *testing.T) {
+	const bucket = "autoindex-bucket"
+	objects := map[string]mockObject{
+		"index.html":                 {data: []byte("home"), contentType: "text/html"},
+		"downloads/app-1.0.zip":      {data: []byte("zip one"), contentType: "application/zip"},
+		"downloads/app-1.1.zip":      {data: []byte("zip two!"), contentType: "application/zip"},
+		"downloads/<script>.txt":     {data: []byte("x"), contentType: "text/plain"},
+		"downloads/nightly/a.tar.gz": {data: []byte("nightly"), contentType: "application/gzip"},
+		"downloads/.spray/x.toml":    {data: []byte("x"), contentType: "application/toml"},
+		"docs/guide.html":            {data: []byte("guide"), contentType: "text/html"},
+		"artifacts/index.html":       {data: []byte("artifacts home"), contentType: "text/html"},
+	}
+	headers := getDefaultHeaderConfig()
+	headers.Autoindex = AutoindexConfig{Enabled: true, Prefixes: []string{"/downloads", "/artifacts"}, PageSize: 3}
+	server := &gcsServer{
+		store:      &mockObjectStore{objects: objects},
+		bucketName: bucket,
+		logger:     &mockLogger{},
+		headers:    headers,
+	}
+
+	serve := func(method, path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	decode := func(t *testing.T, rr *httptest.ResponseRecorder) autoindexListing {
+		t.Helper()
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		var listing autoindexListing
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&listing))
+		return listing
+	}
+
+	t.Run("json listing with pagination", func(t *testing.T) {
+		before := testutil.ToFloat64(autoindexRequests.WithLabelValues(bucket, "json"))
+		listing := decode(t, serve(http.MethodGet, "/downloads/", "application/json"))
+		assert.Equal(t, "/downloads/", listing.Path)
+		require.Len(t, listing.Entries, 2, "the .spray directory is hidden from the first page")
+		assert.Equal(t, autoindexEntry{Name: "<script>.txt", Path: "/downloads/%3Cscript%3E.txt", Type: "file", Size: 1, ContentType: "text/plain"}, listing.Entries[0])
+		assert.Equal(t, "app-1.0.zip", listing.Entries[1].Name)
+		assert.Equal(t, int64(7), listing.Entries[1].Size)
+		require.NotEmpty(t, listing.NextPage)
+		assert.Equal(t, before+1, testutil.ToFloat64(autoindexRequests.WithLabelValues(bucket, "json")))
+
+		listing = decode(t, serve(http.MethodGet, listing.NextPage, "application/json"))
+		require.Len(t, listing.Entries, 2)
+		assert.Equal(t, "app-1.1.zip", listing.Entries[0].Name)
+		assert.Equal(t, autoindexEntry{Name: "nightly/", Path: "/downloads/nightly/", Type: "directory"}, listing.Entries[1])
+		assert.Empty(t, listing.NextPage)
+	})
+
+	t.Run("html listing for browsers", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/downloads/nightly/", "text/html,application/xhtml+xml")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+		body := rr.Body.String()
+		assert.Contains(t, body, "Index of /downloads/nightly/")
+		assert.Contains(t, body, `<a href="../">../</a>`)
+		assert.Contains(t, body, `<a href="/downloads/nightly/a.tar.gz">a.tar.gz</a>`)
+		assert.Contains(t, body, "7 B")
+	})
+
+	t.Run("object names are escaped in html", func(t *testing.T) {
+		body := serve(http.MethodGet, "/downloads/", "text/html").Body.String()
+		assert.NotContains(t, body, "<script>")
+		assert.Contains(t, body, "&lt;script&gt;.txt")
+	})
+
+	t.Run("head has no body", func(t *testing.T) {
+		rr := serve(http.MethodHead, "/downloads/", "application/json")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Body.String())
+	})
+
+	t.Run("index.html wins over the listing", func(t *testing.T) {
+		assert.Equal(t, "artifacts home", serve(http.MethodGet, "/artifacts/", "").Body.String())
+	})
+
+	t.Run("only configured prefixes are listed", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/docs/", "application/json").Code)
+		assert.Equal(t, "home", serve(http.MethodGet, "/", "").Body.String())
+	})
+
+	t.Run("missing directories are not found", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/downloads/missing/", "application/json").Code)
+	})
+
+	t.Run("paths without a trailing slash are not listed", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/downloads", "application/json").Code)
+	})
+
+	t.Run("listing errors", func(t *testing.T) {
+		failing := &gcsServer{store: &errorObjectStore{}, bucketName: bucket, logger: &mockLogger{}, headers: headers}
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/downloads/", nil)
+		req.Header.Set("Accept", "application/json")
+		failing.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestServeHTTP_AutoindexDisabled(t *testing.T) {
+	headers := getDefaultHeaderConfig()
+	headers.Autoindex = AutoindexConfig{Enabled: true}
+	server := &gcsServer{
+		store:      &mockObjectStore{objects: map[string]mockObject{"downloads/a.zip": {data: []byte("a")}}},
+		bucketName: "autoindex-disabled-bucket",
+		logger:     &mockLogger{},
+		headers:    headers,
+	}
+
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/downloads/", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code, "enabling without prefixes lists nothing")
+}
+
+func TestLoadHeaders_AutoindexPageSize(t *testing.T) {
+	_, _, err := loadHeaders(t.Context(), &mockHeaderStore{content: "[autoindex]\nenabled = true\npage_size = 5000\n"})
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "page_size"))
+	assert.Contains(t, err.Error(), "must be between 0 and 1000 (0 = default)")
+
+	headers, _, err := loadHeaders(t.Context(), &mockHeaderStore{content: "[autoindex]\nenabled = true\nprefixes = [\"/downloads\"]\n"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/downloads"}, headers.Autoindex.Prefixes)
+}
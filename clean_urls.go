@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// Trailing slash policies for clean URLs
+const (
+	trailingSlashAlways = "always" // pages are canonical with a trailing slash
+	trailingSlashNever  = "never"  // pages are canonical without a trailing slash
+	trailingSlashAuto   = "auto"   // directory indexes take a slash, path.html pages do not
+)
+
+// validTrailingSlashPolicies are the values accepted for trailing_slash; empty disables redirects
+var validTrailingSlashPolicies = map[string]bool{
+	"":                  true,
+	trailingSlashAlways: true,
+	trailingSlashNever:  true,
+	trailingSlashAuto:   true,
+}
+
+// Kinds of object a clean URL can resolve to
+const (
+	cleanURLExact = "exact" // the path itself
+	cleanURLHTML  = "html"  // path.html
+	cleanURLIndex = "index" // path/index.html
+)
+
+// CleanURLsConfig controls resolving extensionless URLs the way static site generators lay out pages
+type CleanURLsConfig struct {
+	Enabled       bool   `toml:"enabled" json:"enabled"`
+	TrailingSlash string `toml:"trailing_slash" json:"trailing_slash"` // always, never or auto; default: no redirects
+}
+
+// cleanURLCandidate is an object key tried for a clean URL
+type cleanURLCandidate struct {
+	path string
+	kind string
+}
+
+// cleanURLCandidates returns the object keys tried for a page path (without leading or
+// trailing slash), in order. Requests with a trailing slash prefer the directory index.
+func cleanURLCandidates(page string, hasSlash bool) []cleanURLCandidate {
+	index := cleanURLCandidate{path: page + "/index.html", kind: cleanURLIndex}
+	html := cleanURLCandidate{path: page + ".html", kind: cleanURLHTML}
+	if ext := path.Ext(page); ext == ".html" || ext == ".htm" {
+		if hasSlash {
+			return []cleanURLCandidate{index}
+		}
+		return []cleanURLCandidate{{path: page, kind: cleanURLExact}, index}
+	}
+
+	if hasSlash {
+		return []cleanURLCandidate{index, html}
+	}
+	return []cleanURLCandidate{{path: page, kind: cleanURLExact}, html, index}
+}
+
+// canonicalTrailingSlash reports whether the canonical URL of a page resolved to kind
+// ends in a slash under the given policy
+func canonicalTrailingSlash(policy, kind string, hasSlash bool) bool {
+	switch policy {
+	case trailingSlashAlways:
+		return true
+	case trailingSlashNever:
+		return false
+	case trailingSlashAuto:
+		return kind == cleanURLIndex
+	default:
+		return hasSlash
+	}
+}
+
+// resolveObject looks up the object for a request and returns its key and attributes.
+// With clean URLs enabled it also tries path.html and path/index.html, and returns the
+// canonical URL when the trailing slash policy wants the client redirected there.
+func (s *gcsServer) resolveObject(ctx context.Context, r *http.Request, cleanPath string, rewritten bool) (string, *storage.ObjectAttrs, string, error) {
+	lookup := func(objectPath string) (*storage.ObjectAttrs, error) {
+		gcsStart := time.Now()
+		attrs, err := s.store.GetObjectAttrs(ctx, objectPath)
+		gcsLatency.WithLabelValues(s.bucketName, "get_attrs").Observe(time.Since(gcsStart).Seconds())
+		return attrs, err
+	}
+
+	page := strings.Trim(redirectMatchPath(r.URL.Path, cleanPath), "/")
+	if s.headers == nil || !s.headers.CleanURLs.Enabled || rewritten || page == "" {
+		attrs, err := lookup(cleanPath)
+		return cleanPath, attrs, "", err
+	}
+	config := &s.headers.CleanURLs
+
+	hasSlash := strings.HasSuffix(r.URL.Path, "/")
+	var lastErr error
+	for _, candidate := range cleanURLCandidates(page, hasSlash) {
+		attrs, err := lookup(candidate.path)
+		if err == storage.ErrObjectNotExist {
+			lastErr = err
+			continue
+		}
+		if err != nil {
+			return candidate.path, nil, "", err
+		}
+		if candidate.kind == cleanURLExact {
+			return candidate.path, attrs, "", nil
+		}
+
+		wantSlash := canonicalTrailingSlash(config.TrailingSlash, candidate.kind, hasSlash)
+		if wantSlash != hasSlash && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			canonical := &url.URL{Path: "/" + page, RawQuery: r.URL.RawQuery}
+			if wantSlash {
+				canonical.Path += "/"
+			}
+			cleanURLRequests.WithLabelValues(s.bucketName, "redirect").Inc()
+			return candidate.path, attrs, canonical.String(), nil
+		}
+		cleanURLRequests.WithLabelValues(s.bucketName, candidate.kind).Inc()
+		return candidate.path, attrs, "", nil
+	}
+	return cleanPath, nil, "", lastErr
+}
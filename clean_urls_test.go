@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanURLCandidates(t *testing.T) {
+	assert.Equal(t, []cleanURLCandidate{
+		{path: "about", kind: cleanURLExact},
+		{path: "about.html", kind: cleanURLHTML},
+		{path: "about/index.html", kind: cleanURLIndex},
+	}, cleanURLCandidates("about", false))
+	assert.Equal(t, []cleanURLCandidate{
+		{path: "about/index.html", kind: cleanURLIndex},
+		{path: "about.html", kind: cleanURLHTML},
+	}, cleanURLCandidates("about", true))
+	assert.Equal(t, []cleanURLCandidate{
+		{path: "about.html", kind: cleanURLExact},
+		{path: "about.html/index.html", kind: cleanURLIndex},
+	}, cleanURLCandidates("about.html", false))
+}
+
+func TestCanonicalTrailingSlash(t *testing.T) {
+	assert.True(t, canonicalTrailingSlash(trailingSlashAlways, cleanURLHTML, false))
+	assert.False(t, canonicalTrailingSlash(trailingSlashNever, cleanURLIndex, true))
+	assert.True(t, canonicalTrailingSlash(trailingSlashAuto, cleanURLIndex, false))
+	assert.False(t, canonicalTrailingSlash(trailingSlashAuto, cleanURLHTML, true))
+	assert.True(t, canonicalTrailingSlash("", cleanURLHTML, true))
+	assert.False(t, canonicalTrailingSlash("", cleanURLIndex, false))
+}
+
+func TestServeHTTP_CleanURLs(t *testing.T) {
+	objects := map[string]mockObject{
+		"index.html":      {data: []byte("home"), contentType: "text/html"},
+		"about.html":      {data: []byte("about page"), contentType: "text/html"},
+		"blog/index.html": {data: []byte("blog index"), contentType: "text/html"},
+		"feed":            {data: []byte("feed"), contentType: "application/rss+xml"},
+	}
+	headers := getDefaultHeaderConfig()
+	headers.CleanURLs.Enabled = true
+	server := &gcsServer{
+		store:      &mockObjectStore{objects: objects},
+		bucketName: "clean-urls-bucket",
+		logger:     &mockLogger{},
+		headers:    headers,
+	}
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	t.Run("resolution without redirects", func(t *testing.T) {
+		tests := map[string]string{
+			"/about":      "about page",
+			"/about/":     "about page",
+			"/about.html": "about page",
+			"/blog":       "blog index",
+			"/blog/":      "blog index",
+			"/feed":       "feed",
+			"/":           "home",
+		}
+		for path, body := range tests {
+			rr := serve(http.MethodGet, path)
+			assert.Equal(t, http.StatusOK, rr.Code, path)
+			assert.Equal(t, body, rr.Body.String(), path)
+		}
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/missing").Code)
+	})
+
+	policies := []struct {
+		policy    string
+		redirects map[string]string // request path -> Location, empty when served directly
+	}{
+		{trailingSlashAlways, map[string]string{"/about": "/about/", "/about/": "", "/blog": "/blog/", "/blog/": "", "/feed": ""}},
+		{trailingSlashNever, map[string]string{"/about": "", "/about/": "/about", "/blog": "", "/blog/": "/blog", "/feed": ""}},
+		{trailingSlashAuto, map[string]string{"/about": "", "/about/": "/about", "/blog": "/blog/", "/blog/": "", "/feed": ""}},
+	}
+	for _, tt := range policies {
+		t.Run(tt.policy, func(t *testing.T) {
+			headers.CleanURLs.TrailingSlash = tt.policy
+			defer func() { headers.CleanURLs.TrailingSlash = "" }()
+
+			for path, location := range tt.redirects {
+				rr := serve(http.MethodGet, path)
+				if location == "" {
+					assert.Equal(t, http.StatusOK, rr.Code, path)
+					continue
+				}
+				assert.Equal(t, http.StatusMovedPermanently, rr.Code, path)
+				assert.Equal(t, location, rr.Header().Get("Location"), path)
+			}
+		})
+	}
+
+	t.Run("redirect keeps the query string", func(t *testing.T) {
+		headers.CleanURLs.TrailingSlash = trailingSlashAlways
+		defer func() { headers.CleanURLs.TrailingSlash = "" }()
+
+		rr := serve(http.MethodGet, "/blog?page=2")
+		assert.Equal(t, "/blog/?page=2", rr.Header().Get("Location"))
+	})
+
+	t.Run("other methods are not redirected", func(t *testing.T) {
+		headers.CleanURLs.TrailingSlash = trailingSlashAlways
+		defer func() { headers.CleanURLs.TrailingSlash = "" }()
+
+		assert.NotEqual(t, http.StatusMovedPermanently, serve(http.MethodPost, "/blog").Code)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		headers.CleanURLs.Enabled = false
+		defer func() { headers.CleanURLs.Enabled = true }()
+
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/about").Code)
+	})
+}
+
+func TestLoadHeaders_InvalidTrailingSlash(t *testing.T) {
+	store := &mockObjectStore{objects: map[string]mockObject{
+		".spray/headers.toml": {data: []byte("[clean_urls]\nenabled = true\ntrailing_slash = \"sometimes\"\n")},
+	}}
+	_, _, err := loadHeaders(context.Background(), store)
+	assert.Error(t, err)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync/atomic"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultCoalesceBufferSize is the largest object body shared between coalesced requests
+const defaultCoalesceBufferSize = 1 << 20 // 1 MiB
+
+// coalescedObject is the result of a fetch shared by concurrent requests
+type coalescedObject struct {
+	attrs *storage.ObjectAttrs
+	data  []byte
+
+	// reader is set instead of data when the body is too large to buffer.
+	// It can only be handed to a single caller.
+	reader  io.ReadCloser
+	claimed atomic.Bool
+}
+
+// coalescingObjectStore is an ObjectStore decorator that lets concurrent requests
+// for the same path share a single backend fetch. Metadata lookups and whole-object
+// reads are coalesced; ranged reads always go to the backend.
+type coalescingObjectStore struct {
+	store         ObjectStore
+	bucketName    string
+	maxBufferSize int64
+	group         singleflight.Group
+}
+
+// newCoalescingObjectStore wraps store so that concurrent fetches are coalesced
+func newCoalescingObjectStore(bucketName string, store ObjectStore) *coalescingObjectStore {
+	return &coalescingObjectStore{
+		store:         store,
+		bucketName:    bucketName,
+		maxBufferSize: defaultCoalesceBufferSize,
+	}
+}
+
+// GetObject shares one backend read between concurrent requests for path
+func (c *coalescingObjectStore) GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return c.shareRead(ctx, "object:"+path, func(ctx context.Context) (io.ReadCloser, *storage.ObjectAttrs, error) {
+		return c.store.GetObject(ctx, path)
+	})
+}
+
+// shareRead runs read once for all concurrent requests with the same key and hands
+// each of them the body
+func (c *coalescingObjectStore) shareRead(ctx context.Context, key string, read func(context.Context) (io.ReadCloser, *storage.ObjectAttrs, error)) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	leader := false
+	v, err, shared := c.group.Do(key, func() (any, error) {
+		leader = true
+		// The fetch serves every waiting request, so it must outlive the leader's cancellation
+		return c.fetchObject(read(context.WithoutCancel(ctx)))
+	})
+	if shared && !leader {
+		coalescedRequests.WithLabelValues(c.bucketName, "get_object").Inc()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj := v.(*coalescedObject)
+	if obj.reader != nil {
+		if obj.claimed.CompareAndSwap(false, true) {
+			return obj.reader, copyObjectAttrs(obj.attrs), nil
+		}
+		// Another request owns the stream of this large object; read it independently
+		return read(ctx)
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), copyObjectAttrs(obj.attrs), nil
+}
+
+// fetchObject takes the result of a backend read, buffering bodies small enough to share
+func (c *coalescingObjectStore) fetchObject(reader io.ReadCloser, attrs *storage.ObjectAttrs, err error) (*coalescedObject, error) {
+	if err != nil {
+		return nil, err
+	}
+	if attrs.Size > c.maxBufferSize {
+		return &coalescedObject{attrs: attrs, reader: reader}, nil
+	}
+
+	// Read one byte past the limit in case the reported size is unreliable
+	data, err := io.ReadAll(io.LimitReader(reader, c.maxBufferSize+1))
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	if int64(len(data)) > c.maxBufferSize {
+		return &coalescedObject{
+			attrs:  attrs,
+			reader: &rangeReadCloser{Reader: io.MultiReader(bytes.NewReader(data), reader), Closer: reader},
+		}, nil
+	}
+	reader.Close()
+	return &coalescedObject{attrs: attrs, data: data}, nil
+}
+
+// GetObjectRange coalesces whole-object reads; other ranges go straight to the backend.
+// Whole-object reads stay ranged reads, which return metadata without a second lookup.
+func (c *coalescingObjectStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	if offset == 0 && length < 0 {
+		return c.shareRead(ctx, "range:"+path, func(ctx context.Context) (io.ReadCloser, *storage.ObjectAttrs, error) {
+			return c.store.GetObjectRange(ctx, path, 0, -1)
+		})
+	}
+	return c.store.GetObjectRange(ctx, path, offset, length)
+}
+
+// GetObjectAttrs shares one metadata lookup between concurrent requests for path
+func (c *coalescingObjectStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	leader := false
+	v, err, shared := c.group.Do("attrs:"+path, func() (any, error) {
+		leader = true
+		return c.store.GetObjectAttrs(context.WithoutCancel(ctx), path)
+	})
+	if shared && !leader {
+		coalescedRequests.WithLabelValues(c.bucketName, "get_attrs").Inc()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return copyObjectAttrs(v.(*storage.ObjectAttrs)), nil
+}
+
+// ListObjects passes listings straight to the backend
+func (c *coalescingObjectStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	return c.store.ListObjects(ctx, prefix, pageToken, limit)
+}
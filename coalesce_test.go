@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingObjectStore holds every fetch until release is closed and counts backend calls
+type blockingObjectStore struct {
+	mockObjectStore
+	release    chan struct{}
+	bodyReads  atomic.Int32
+	attrsReads atomic.Int32
+}
+
+func (s *blockingObjectStore) GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	s.bodyReads.Add(1)
+	<-s.release
+	return s.mockObjectStore.GetObject(ctx, path)
+}
+
+func (s *blockingObjectStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	s.bodyReads.Add(1)
+	<-s.release
+	return s.mockObjectStore.GetObjectRange(ctx, path, offset, length)
+}
+
+func (s *blockingObjectStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	s.attrsReads.Add(1)
+	<-s.release
+	return s.mockObjectStore.GetObjectAttrs(ctx, path)
+}
+
+// runConcurrently calls fn from n goroutines that start together and waits for them
+func runConcurrently(n int, release chan struct{}, fn func(i int)) {
+	var started, done sync.WaitGroup
+	started.Add(n)
+	done.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer done.Done()
+			started.Done()
+			fn(i)
+		}(i)
+	}
+	started.Wait()
+	// Give every goroutine time to join the in-flight fetch before it completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	done.Wait()
+}
+
+func TestCoalescingObjectStore_GetObject(t *testing.T) {
+	const bucket = "coalesce-get-object"
+	const n = 10
+	backing := &blockingObjectStore{
+		mockObjectStore: mockObjectStore{objects: map[string]mockObject{
+			"index.html": {data: []byte("<h1>deploy</h1>"), contentType: "text/html"},
+		}},
+		release: make(chan struct{}),
+	}
+	store := newCoalescingObjectStore(bucket, backing)
+
+	bodies := make([]string, n)
+	runConcurrently(n, backing.release, func(i int) {
+		reader, attrs, err := store.GetObject(context.Background(), "index.html")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer reader.Close()
+		data, _ := io.ReadAll(reader)
+		bodies[i] = string(data)
+		assert.Equal(t, "text/html", attrs.ContentType)
+	})
+
+	assert.Equal(t, int32(1), backing.bodyReads.Load(), "concurrent requests should share one fetch")
+	for _, body := range bodies {
+		assert.Equal(t, "<h1>deploy</h1>", body)
+	}
+	assert.Equal(t, float64(n-1), testutil.ToFloat64(coalescedRequests.WithLabelValues(bucket, "get_object")))
+
+	// Once the fetch completes, later requests fetch again
+	_, _, err := store.GetObjectRange(context.Background(), "index.html", 0, -1)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), backing.bodyReads.Load())
+}
+
+func TestCoalescingObjectStore_GetObjectAttrs(t *testing.T) {
+	const bucket = "coalesce-get-attrs"
+	const n = 5
+	backing := &blockingObjectStore{
+		mockObjectStore: mockObjectStore{objects: map[string]mockObject{
+			"app.js": {data: []byte("x"), contentType: "application/javascript"},
+		}},
+		release: make(chan struct{}),
+	}
+	store := newCoalescingObjectStore(bucket, backing)
+
+	runConcurrently(n, backing.release, func(i int) {
+		attrs, err := store.GetObjectAttrs(context.Background(), "app.js")
+		if assert.NoError(t, err) {
+			assert.Equal(t, int64(1), attrs.Size)
+		}
+	})
+
+	assert.Equal(t, int32(1), backing.attrsReads.Load())
+	assert.Equal(t, float64(n-1), testutil.ToFloat64(coalescedRequests.WithLabelValues(bucket, "get_attrs")))
+}
+
+func TestCoalescingObjectStore_LargeObject(t *testing.T) {
+	const n = 4
+	backing := &blockingObjectStore{
+		mockObjectStore: mockObjectStore{objects: map[string]mockObject{
+			"video.mp4": {data: []byte("0123456789"), contentType: "video/mp4"},
+		}},
+		release: make(chan struct{}),
+	}
+	store := newCoalescingObjectStore("coalesce-large", backing)
+	store.maxBufferSize = 4
+
+	bodies := make([]string, n)
+	runConcurrently(n, backing.release, func(i int) {
+		reader, _, err := store.GetObject(context.Background(), "video.mp4")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer reader.Close()
+		data, _ := io.ReadAll(reader)
+		bodies[i] = string(data)
+	})
+
+	// The shared stream goes to one request; the others read the object themselves
+	assert.Equal(t, int32(n), backing.bodyReads.Load())
+	for _, body := range bodies {
+		assert.Equal(t, "0123456789", body)
+	}
+}
+
+func TestCoalescingObjectStore_Passthrough(t *testing.T) {
+	backing := &versionedObjectStore{objects: map[string]versionedObject{
+		"data.bin": {data: "0123456789", generation: 1},
+	}}
+	store := newCoalescingObjectStore("coalesce-passthrough", backing)
+
+	reader, attrs, err := store.GetObjectRange(context.Background(), "data.bin", 2, 3)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(reader)
+	assert.Equal(t, "234", string(data))
+	assert.Equal(t, int64(10), attrs.Size)
+
+	_, _, err = store.GetObject(context.Background(), "missing.bin")
+	assert.Equal(t, storage.ErrObjectNotExist, err)
+	_, err = store.GetObjectAttrs(context.Background(), "missing.bin")
+	assert.Equal(t, storage.ErrObjectNotExist, err)
+}
+
+// backendCallStore counts each kind of backend call
+type backendCallStore struct {
+	mockObjectStore
+	objectReads atomic.Int32
+	rangeReads  atomic.Int32
+	attrsReads  atomic.Int32
+}
+
+func (s *backendCallStore) GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	s.objectReads.Add(1)
+	return s.mockObjectStore.GetObject(ctx, path)
+}
+
+func (s *backendCallStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	s.rangeReads.Add(1)
+	return s.mockObjectStore.GetObjectRange(ctx, path, offset, length)
+}
+
+func (s *backendCallStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	s.attrsReads.Add(1)
+	return s.mockObjectStore.GetObjectAttrs(ctx, path)
+}
+
+func TestCoalescingObjectStore_ServesGetWithOneBodyRead(t *testing.T) {
+	backing := &backendCallStore{mockObjectStore: mockObjectStore{objects: map[string]mockObject{
+		"index.html": {data: []byte("<h1>home</h1>"), contentType: "text/html"},
+	}}}
+	server := &gcsServer{
+		store:      servingStore(&config{store: backing, bucketName: "coalesce-backend-calls", headers: getDefaultHeaderConfig()}),
+		bucketName: "coalesce-backend-calls",
+		logger:     &mockLogger{},
+		headers:    getDefaultHeaderConfig(),
+	}
+
+	for i := 1; i <= 2; i++ {
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/index.html", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "<h1>home</h1>", rr.Body.String())
+
+		// The body is a ranged read, which returns metadata without another lookup
+		assert.Equal(t, int32(i), backing.rangeReads.Load(), "one body read per GET")
+		assert.Equal(t, int32(i), backing.attrsReads.Load(), "one metadata lookup per GET")
+		assert.Zero(t, backing.objectReads.Load(), "GetObject costs a second metadata lookup on GCS")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+)
+
+// defaultCompressionMinSize is the smallest object compressed on the fly
+const defaultCompressionMinSize = 1024
+
+// defaultCompressibleContentTypes are compressed on the fly unless configured otherwise
+var defaultCompressibleContentTypes = []string{
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/javascript",
+	"application/javascript",
+	"application/json",
+	"image/svg+xml",
+}
+
+// CompressionConfig controls on-the-fly gzip compression of responses
+type CompressionConfig struct {
+	Enabled      bool     `toml:"enabled" json:"enabled"`
+	MinSize      int64    `toml:"min_size" json:"min_size"`           // bytes, default: 1024
+	ContentTypes []string `toml:"content_types" json:"content_types"` // media types, "type/*" wildcards allowed
+}
+
+// gzipWriterPool reuses gzip writers across responses
+var gzipWriterPool = sync.Pool{
+	New: func() any { return gzip.NewWriter(io.Discard) },
+}
+
+// contentTypeAllowed reports whether contentType matches an entry in allowed.
+// Entries match the media type exactly or, as "type/*", any subtype.
+func contentTypeAllowed(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	mediaType = strings.ToLower(mediaType)
+	if mediaType == "" {
+		return false
+	}
+
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(entry, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// compressible reports whether on-the-fly compression applies to the object,
+// regardless of what the client accepts
+func (s *gcsServer) compressible(attrs *storage.ObjectAttrs) bool {
+	config := &s.headers.Compression
+	if !config.Enabled || attrs.ContentEncoding != "" {
+		return false
+	}
+
+	minSize := config.MinSize
+	if minSize <= 0 {
+		minSize = defaultCompressionMinSize
+	}
+	if attrs.Size < minSize {
+		return false
+	}
+
+	contentTypes := config.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = defaultCompressibleContentTypes
+	}
+	return contentTypeAllowed(attrs.ContentType, contentTypes)
+}
+
+// negotiateCompression decides whether the response is gzip-compressed on the fly.
+// It sets Vary for compressible objects and returns the attributes describing the
+// served representation, whose ETag differs from the uncompressed one.
+func (s *gcsServer) negotiateCompression(w http.ResponseWriter, r *http.Request, attrs *storage.ObjectAttrs) (*storage.ObjectAttrs, bool) {
+	if !s.compressible(attrs) {
+		return attrs, false
+	}
+	addVary(w.Header(), "Accept-Encoding")
+
+	// Ranges are served from the uncompressed object
+	if r.Header.Get("Range") != "" || len(negotiateEncodings(r.Header.Get("Accept-Encoding"), []string{"gzip"})) == 0 {
+		return attrs, false
+	}
+
+	compressed := copyObjectAttrs(attrs)
+	compressed.ContentEncoding = "gzip"
+	w.Header().Set("Content-Encoding", "gzip")
+	return compressed, true
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// copyCompressed gzip-compresses reader into w and returns the number of compressed
+// bytes written. Bytes saved by compression are recorded per content type.
+func (s *gcsServer) copyCompressed(w io.Writer, reader io.Reader, contentType string) (int64, error) {
+	out := &countingWriter{w: w}
+	gz := gzipWriterPool.Get().(*gzip.Writer)
+	gz.Reset(out)
+	defer gzipWriterPool.Put(gz)
+
+	read, err := io.Copy(gz, reader)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return out.n, err
+	}
+
+	if saved := read - out.n; saved > 0 {
+		compressionBytesSaved.WithLabelValues(s.bucketName, contentType).Add(float64(saved))
+	}
+	return out.n, nil
+}
+
+// addVary adds value to the Vary header unless it is already listed
+func addVary(header http.Header, value string) {
+	for _, existing := range header.Values("Vary") {
+		for _, field := range strings.Split(existing, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentTypeAllowed(t *testing.T) {
+	allowed := []string{"text/html", "application/json", "font/*"}
+
+	assert.True(t, contentTypeAllowed("text/html", allowed))
+	assert.True(t, contentTypeAllowed("text/html; charset=utf-8", allowed))
+	assert.True(t, contentTypeAllowed("Application/JSON", allowed))
+	assert.True(t, contentTypeAllowed("font/woff2", allowed))
+	assert.False(t, contentTypeAllowed("text/css", allowed))
+	assert.False(t, contentTypeAllowed("image/png", allowed))
+	assert.False(t, contentTypeAllowed("", allowed))
+}
+
+func TestAddVary(t *testing.T) {
+	header := http.Header{}
+	addVary(header, "Accept-Encoding")
+	addVary(header, "accept-encoding")
+	assert.Equal(t, []string{"Accept-Encoding"}, header.Values("Vary"))
+
+	header = http.Header{"Vary": {"Origin, Accept-Encoding"}}
+	addVary(header, "Accept-Encoding")
+	assert.Equal(t, []string{"Origin, Accept-Encoding"}, header.Values("Vary"))
+}
+
+func TestServeHTTP_Compression(t *testing.T) {
+	const bucket = "compression-bucket"
+	page := "<html><body>" + strings.Repeat("<p>compressible content</p>", 100) + "</body></html>"
+	objects := map[string]mockObject{
+		"index.html":  {data: []byte(page), contentType: "text/html; charset=utf-8"},
+		"small.css":   {data: []byte("body{}"), contentType: "text/css"},
+		"photo.png":   {data: []byte(strings.Repeat("x", 4096)), contentType: "image/png"},
+		"app.js":      {data: []byte(strings.Repeat("var a = 1;\n", 200)), contentType: "application/javascript"},
+		"app.js.br":   {data: []byte("BR"), contentType: "application/x-brotli"},
+		"data.json":   {data: []byte(strings.Repeat(`{"k":"v"},`, 200)), contentType: "application/json"},
+		"custom.json": {data: []byte(strings.Repeat(`{"k":"v"},`, 200)), contentType: "application/json"},
+	}
+	headers := getDefaultHeaderConfig()
+	headers.Cache.Enabled = true
+	headers.Compression.Enabled = true
+	server := &gcsServer{
+		store:      &mockObjectStore{objects: objects},
+		bucketName: bucket,
+		logger:     &mockLogger{},
+		headers:    headers,
+	}
+
+	serve := func(method, path string, extra map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for k, v := range extra {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+	gunzip := func(t *testing.T, body []byte) string {
+		t.Helper()
+		gz, err := gzip.NewReader(strings.NewReader(string(body)))
+		require.NoError(t, err)
+		data, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	t.Run("compresses when accepted", func(t *testing.T) {
+		savedBefore := testutil.ToFloat64(compressionBytesSaved.WithLabelValues(bucket, "text/html; charset=utf-8"))
+
+		rr := serve(http.MethodGet, "/", map[string]string{"Accept-Encoding": "gzip, deflate, br"})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+		assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Less(t, rr.Body.Len(), len(page))
+		assert.Equal(t, page, gunzip(t, rr.Body.Bytes()))
+
+		saved := testutil.ToFloat64(compressionBytesSaved.WithLabelValues(bucket, "text/html; charset=utf-8")) - savedBefore
+		assert.Equal(t, float64(len(page)-rr.Body.Len()), saved)
+	})
+
+	t.Run("identity when not accepted", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/", nil)
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+		assert.Equal(t, page, rr.Body.String())
+
+		gzipped := serve(http.MethodGet, "/", map[string]string{"Accept-Encoding": "gzip"})
+		assert.NotEqual(t, rr.Header().Get("ETag"), gzipped.Header().Get("ETag"))
+	})
+
+	t.Run("conditional request for compressed representation", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/data.json", map[string]string{"Accept-Encoding": "gzip"})
+		require.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+
+		rr = serve(http.MethodGet, "/data.json", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": rr.Header().Get("ETag")})
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+	})
+
+	t.Run("skips small objects", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/small.css", map[string]string{"Accept-Encoding": "gzip"})
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Empty(t, rr.Header().Get("Vary"))
+		assert.Equal(t, "body{}", rr.Body.String())
+	})
+
+	t.Run("skips content types outside the allowlist", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/photo.png", map[string]string{"Accept-Encoding": "gzip"})
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, 4096, rr.Body.Len())
+	})
+
+	t.Run("range requests are served uncompressed", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/", map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=0-5"})
+		assert.Equal(t, http.StatusPartialContent, rr.Code)
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, "<html>", rr.Body.String())
+	})
+
+	t.Run("HEAD omits the unknown length", func(t *testing.T) {
+		rr := serve(http.MethodHead, "/", map[string]string{"Accept-Encoding": "gzip"})
+		assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+		assert.Empty(t, rr.Header().Get("Content-Length"))
+		assert.Empty(t, rr.Body.String())
+	})
+
+	t.Run("precompressed variants take precedence", func(t *testing.T) {
+		headers.Precompressed.Enabled = true
+		defer func() { headers.Precompressed.Enabled = false }()
+
+		rr := serve(http.MethodGet, "/app.js", map[string]string{"Accept-Encoding": "br, gzip"})
+		assert.Equal(t, "br", rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, "BR", rr.Body.String())
+		assert.Equal(t, []string{"Accept-Encoding"}, rr.Header().Values("Vary"))
+
+		rr = serve(http.MethodGet, "/app.js", map[string]string{"Accept-Encoding": "gzip"})
+		assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"), "dynamic gzip covers encodings without a variant")
+		assert.Equal(t, strings.Repeat("var a = 1;\n", 200), gunzip(t, rr.Body.Bytes()))
+	})
+
+	t.Run("configured allowlist and threshold", func(t *testing.T) {
+		headers.Compression.ContentTypes = []string{"text/*"}
+		headers.Compression.MinSize = 4
+		defer func() {
+			headers.Compression.ContentTypes = nil
+			headers.Compression.MinSize = 0
+		}()
+
+		rr := serve(http.MethodGet, "/small.css", map[string]string{"Accept-Encoding": "gzip"})
+		assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, "body{}", gunzip(t, rr.Body.Bytes()))
+
+		rr = serve(http.MethodGet, "/custom.json", map[string]string{"Accept-Encoding": "gzip"})
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		headers.Compression.Enabled = false
+		defer func() { headers.Compression.Enabled = true }()
+
+		rr := serve(http.MethodGet, "/", map[string]string{"Accept-Encoding": "gzip"})
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, page, rr.Body.String())
+	})
+}
+
+// failingBodyStore returns metadata but fails to open object bodies
+type failingBodyStore struct {
+	mockObjectStore
+}
+
+func (s *failingBodyStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return nil, nil, assert.AnError
+}
+
+func TestServeHTTP_CompressionStorageError(t *testing.T) {
+	headers := getDefaultHeaderConfig()
+	headers.Cache.Enabled = true
+	headers.Compression.Enabled = true
+	server := &gcsServer{
+		store: &failingBodyStore{mockObjectStore{objects: map[string]mockObject{
+			"index.html": {data: []byte(strings.Repeat("<p>compressible</p>", 100)), contentType: "text/html"},
+		}}},
+		bucketName: "compression-error-bucket",
+		logger:     &mockLogger{},
+		headers:    headers,
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/index.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Empty(t, rr.Header().Get("Content-Encoding"), "the error body is not gzipped")
+	assert.Empty(t, rr.Header().Get("ETag"))
+	assert.Empty(t, rr.Header().Get("Cache-Control"))
+	assert.Contains(t, rr.Body.String(), "temporarily unavailable")
+}
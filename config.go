@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -18,63 +20,79 @@ import (
 const (
 	configDir     = ".spray"
 	redirectsFile = "redirects.toml"
+	rewritesFile  = "rewrites.toml"
 	headersFile   = "headers.toml"
 )
 
 type config struct {
-	port       string
-	bucketName string
-	projectID  string
-	store      ObjectStore
-	redirects  map[string]string // path -> destination URL
-	headers    *HeaderConfig     // header configuration
+	port            string
+	bucketName      string
+	projectID       string
+	source          string            // content source, e.g. gs://bucket or file:///srv/site
+	objectCache     ObjectCacheConfig // server-level object cache settings from flags
+	hostsFile       string            // virtual hosts mapping file; serves many sites when set
+	reloadInterval  time.Duration     // how often .spray configuration is polled for changes; 0 disables polling
+	adminToken      string            // bearer token for /admin endpoints, which are disabled when empty
+	configEndpoints string            // public, protected or disabled; see validConfigEndpointModes
+	store           ObjectStore
+	redirects       map[string]RedirectRule // path -> redirect rule
+	rewrites        map[string]string       // path -> object key
+	headers         *HeaderConfig           // header configuration
+	configWarnings  []string                // problems in the configuration files that did not stop loading
 }
 
 // RedirectConfig represents the structure of the redirects.toml file
 type RedirectConfig struct {
-	Redirects map[string]string `toml:"redirects"`
+	Redirects map[string]RedirectRule `toml:"redirects"`
 }
 
 // HeaderConfig represents the structure of the headers.toml file
 type HeaderConfig struct {
-	PoweredBy PoweredByConfig `toml:"powered_by"`
-	Cache     CacheConfig     `toml:"cache"`
+	PoweredBy     PoweredByConfig     `toml:"powered_by" json:"powered_by"`
+	Cache         CacheConfig         `toml:"cache" json:"cache"`
+	ObjectCache   ObjectCacheConfig   `toml:"object_cache" json:"object_cache"`
+	Precompressed PrecompressedConfig `toml:"precompressed" json:"precompressed"`
+	Compression   CompressionConfig   `toml:"compression" json:"compression"`
+	SPA           SPAConfig           `toml:"spa" json:"spa"`
+	CleanURLs     CleanURLsConfig     `toml:"clean_urls" json:"clean_urls"`
+	Autoindex     AutoindexConfig     `toml:"autoindex" json:"autoindex"`
+	Hidden        HiddenConfig        `toml:"hidden" json:"hidden"`
 }
 
 // PoweredByConfig controls the X-Powered-By header behavior
 type PoweredByConfig struct {
-	Enabled bool `toml:"enabled"`
+	Enabled bool `toml:"enabled" json:"enabled"`
 }
 
 // CacheConfig controls HTTP cache behavior
 type CacheConfig struct {
-	Enabled       bool               `toml:"enabled"`
-	ETag          CacheFeatureConfig `toml:"etag"`
-	LastModified  CacheFeatureConfig `toml:"last_modified"`
-	CacheControl  CacheFeatureConfig `toml:"cache_control"`
-	Policies      CachePolicyConfig  `toml:"policies"`
-	RolloutConfig CacheRolloutConfig `toml:"rollout"`
+	Enabled       bool               `toml:"enabled" json:"enabled"`
+	ETag          CacheFeatureConfig `toml:"etag" json:"etag"`
+	LastModified  CacheFeatureConfig `toml:"last_modified" json:"last_modified"`
+	CacheControl  CacheFeatureConfig `toml:"cache_control" json:"cache_control"`
+	Policies      CachePolicyConfig  `toml:"policies" json:"policies"`
+	RolloutConfig CacheRolloutConfig `toml:"rollout" json:"rollout"`
 }
 
 // CacheFeatureConfig controls individual cache features
 type CacheFeatureConfig struct {
-	Enabled bool `toml:"enabled"`
+	Enabled bool `toml:"enabled" json:"enabled"`
 }
 
 // CachePolicyConfig controls cache policy settings
 type CachePolicyConfig struct {
-	ShortMaxAge  int `toml:"short_max_age"`  // seconds, default: 300 (5 minutes)
-	MediumMaxAge int `toml:"medium_max_age"` // seconds, default: 86400 (1 day)
-	LongMaxAge   int `toml:"long_max_age"`   // seconds, default: 31536000 (1 year)
+	ShortMaxAge  int `toml:"short_max_age" json:"short_max_age"`   // seconds, default: 300 (5 minutes)
+	MediumMaxAge int `toml:"medium_max_age" json:"medium_max_age"` // seconds, default: 86400 (1 day)
+	LongMaxAge   int `toml:"long_max_age" json:"long_max_age"`     // seconds, default: 31536000 (1 year)
 }
 
 // CacheRolloutConfig controls gradual rollout of cache features
 type CacheRolloutConfig struct {
-	Enabled         bool     `toml:"enabled"`
-	Percentage      int      `toml:"percentage"`       // 0-100, percentage of requests to apply cache to
-	PathPrefixes    []string `toml:"path_prefixes"`    // only apply cache to these path prefixes
-	ExcludePrefixes []string `toml:"exclude_prefixes"` // exclude these path prefixes from cache
-	UserAgentRules  []string `toml:"user_agent_rules"` // apply cache only to these user agents (regex)
+	Enabled         bool     `toml:"enabled" json:"enabled"`
+	Percentage      int      `toml:"percentage" json:"percentage"`             // 0-100, percentage of requests to apply cache to
+	PathPrefixes    []string `toml:"path_prefixes" json:"path_prefixes"`       // only apply cache to these path prefixes
+	ExcludePrefixes []string `toml:"exclude_prefixes" json:"exclude_prefixes"` // exclude these path prefixes from cache
+	UserAgentRules  []string `toml:"user_agent_rules" json:"user_agent_rules"` // apply cache only to these user agents (regex)
 }
 
 // isPermissionError checks if the error is related to permissions/access denied/authentication
@@ -99,6 +117,21 @@ func isPermissionError(err error) bool {
 
 // validateConfig checks if the config is valid and returns an error if not.
 func validateConfig(cfg *config) error {
+	// In virtual hosting mode every site comes from the hosts file, which is validated on load
+	if cfg.hostsFile != "" {
+		return nil
+	}
+
+	src, err := parseSource(cfg.source)
+	if err != nil {
+		return err
+	}
+
+	// Only GCS sources need a GCP project; file and S3 sources carry their own location
+	if src.scheme != sourceSchemeGCS {
+		return nil
+	}
+
 	if cfg.bucketName == "" {
 		return fmt.Errorf("BUCKET_NAME environment variable is required")
 	}
@@ -108,6 +141,24 @@ func validateConfig(cfg *config) error {
 	return nil
 }
 
+// resolveSource fills in the content source and the bucket name used for
+// metrics and logging. BUCKET_NAME takes precedence over the source location.
+func resolveSource(cfg *config) {
+	if cfg.source == "" {
+		cfg.source = os.Getenv("SPRAY_SOURCE")
+	}
+	if cfg.hostsFile == "" {
+		cfg.hostsFile = os.Getenv("SPRAY_HOSTS_FILE")
+	}
+
+	src, err := parseSource(cfg.source)
+	if err != nil || cfg.bucketName != "" {
+		// Invalid sources are reported by validateConfig
+		return
+	}
+	cfg.bucketName = src.location
+}
+
 // logStructuredWarning logs a structured warning message to stderr in JSON format
 func logStructuredWarning(operation, path string, err error) {
 	warning := map[string]any{
@@ -133,6 +184,72 @@ func logStructuredWarning(operation, path string, err error) {
 	}
 }
 
+// strictConfigDecoding reports whether unknown keys in configuration files are fatal
+func strictConfigDecoding() bool {
+	return os.Getenv("SPRAY_STRICT_CONFIG") == "true"
+}
+
+// undecodedKeys returns the keys in md that no configuration field uses, leaving out
+// keys nested in tables that are themselves unknown
+func undecodedKeys(md toml.MetaData) []string {
+	undecoded := md.Undecoded()
+	unknown := make(map[string]bool, len(undecoded))
+	for _, key := range undecoded {
+		unknown[key.String()] = true
+	}
+
+	var keys []string
+	for _, key := range undecoded {
+		if len(key) > 1 && unknown[key[:len(key)-1].String()] {
+			continue
+		}
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// checkUnknownKeys reports the keys of a decoded configuration file that no setting uses,
+// which are usually misspellings. They are logged, counted and returned as warnings, or
+// fail the load when SPRAY_STRICT_CONFIG is true.
+func checkUnknownKeys(md toml.MetaData, configPath string) ([]string, error) {
+	keys := undecodedKeys(md)
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	configUnknownKeys.WithLabelValues(configPath).Add(float64(len(keys)))
+	if strictConfigDecoding() {
+		redirectConfigErrors.WithLabelValues("", "unknown_key").Inc()
+		return nil, fmt.Errorf("unknown keys in %s: %s", configPath, strings.Join(keys, ", "))
+	}
+
+	warnings := make([]string, len(keys))
+	for i, key := range keys {
+		warnings[i] = fmt.Sprintf("unknown key %q in %s is ignored", key, configPath)
+	}
+	logConfigWarnings("decode_config", configPath, warnings)
+	return warnings, nil
+}
+
+// logConfigWarnings logs warnings about a configuration file to stderr in JSON format
+func logConfigWarnings(operation, path string, warnings []string) {
+	for _, message := range warnings {
+		jsonBytes, err := json.Marshal(map[string]any{
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"severity":  "WARNING",
+			"operation": operation,
+			"path":      path,
+			"message":   message,
+		})
+		if err != nil {
+			log.Printf("Warning: %s", message)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", string(jsonBytes))
+	}
+}
+
 // cleanRedirectPath normalizes a redirect path from the configuration file
 // to match the format used by cleanRequestPath (removes leading slash)
 func cleanRedirectPath(path string) string {
@@ -149,52 +266,76 @@ func cleanRedirectPath(path string) string {
 	return path
 }
 
-// loadRedirects loads redirects from a redirects.toml file in the .spray directory
-func loadRedirects(ctx context.Context, store ObjectStore) (map[string]string, error) {
+// loadRedirects loads redirects from a redirects.toml file in the .spray directory,
+// along with warnings about keys no setting uses
+func loadRedirects(ctx context.Context, store ObjectStore) (map[string]RedirectRule, []string, error) {
 	configPath := filepath.Join(configDir, redirectsFile)
 	reader, _, err := store.GetObject(ctx, configPath)
 	if err != nil {
 		if err == storage.ErrObjectNotExist {
 			// No redirects file is fine, return empty map
-			return make(map[string]string), nil
+			return make(map[string]RedirectRule), nil, nil
 		}
 		// Handle permission errors gracefully - redirects are optional
 		if isPermissionError(err) {
 			redirectConfigErrors.WithLabelValues("", "permission_denied").Inc()
 			logStructuredWarning("load_redirects", configPath, err)
-			return make(map[string]string), nil
+			return make(map[string]RedirectRule), nil, nil
 		}
 		redirectConfigErrors.WithLabelValues("", "read_error").Inc()
-		return nil, fmt.Errorf("error reading redirects file at %s: %v", configPath, err)
+		return nil, nil, fmt.Errorf("error reading redirects file at %s: %v", configPath, err)
 	}
 	defer reader.Close()
 
 	var redirectConfig RedirectConfig
-	if _, err := toml.NewDecoder(reader).Decode(&redirectConfig); err != nil {
+	md, err := toml.NewDecoder(reader).Decode(&redirectConfig)
+	if err != nil {
 		redirectConfigErrors.WithLabelValues("", "parse_error").Inc()
-		return nil, fmt.Errorf("error parsing redirects file at %s: %v", configPath, err)
+		return nil, nil, fmt.Errorf("error parsing redirects file at %s: %v", configPath, err)
+	}
+	warnings, err := checkUnknownKeys(md, configPath)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Initialize redirects map if it's nil
 	if redirectConfig.Redirects == nil {
-		redirectConfig.Redirects = make(map[string]string)
+		redirectConfig.Redirects = make(map[string]RedirectRule)
 	}
 
 	// Clean and validate redirects
-	cleanedRedirects := make(map[string]string)
-	for path, dest := range redirectConfig.Redirects {
-		// Validate destination URL
-		if _, err := url.ParseRequestURI(dest); err != nil {
-			redirectConfigErrors.WithLabelValues("", "invalid_url").Inc()
-			return nil, fmt.Errorf("invalid redirect destination URL for path %q: %v", path, err)
+	cleanedRedirects := make(map[string]RedirectRule)
+	for path, rule := range redirectConfig.Redirects {
+		if errType, err := validateRedirectRule(path, rule); err != nil {
+			redirectConfigErrors.WithLabelValues("", errType).Inc()
+			return nil, nil, err
 		}
-
 		// Clean the redirect path to match request path format
-		cleanedPath := cleanRedirectPath(path)
-		cleanedRedirects[cleanedPath] = dest
+		cleanedRedirects[cleanRedirectPath(path)] = rule
 	}
 
-	return cleanedRedirects, nil
+	return cleanedRedirects, warnings, nil
+}
+
+// validateRedirectRule checks a rule as written in redirects.toml. On failure it
+// returns the error type recorded in redirectConfigErrors along with the error.
+func validateRedirectRule(path string, rule RedirectRule) (string, error) {
+	// Validate destination URL
+	if _, err := url.ParseRequestURI(rule.To); err != nil {
+		return "invalid_url", fmt.Errorf("invalid redirect destination URL for path %q: %v", path, err)
+	}
+	if rule.Status != 0 && !validRedirectStatuses[rule.Status] {
+		return "invalid_status", fmt.Errorf("invalid redirect status %d for path %q: must be 301, 302, 307 or 308", rule.Status, path)
+	}
+	if rule.Query != "" && !validQueryModes[rule.Query] {
+		return "invalid_query", fmt.Errorf("invalid redirect query mode %q for path %q: must be drop, preserve or merge", rule.Query, path)
+	}
+	if cleanedPath := cleanRedirectPath(path); isRedirectPattern(cleanedPath) {
+		if _, err := compileRedirectPattern(cleanedPath, rule); err != nil {
+			return "invalid_pattern", err
+		}
+	}
+	return "", nil
 }
 
 // getDefaultHeaderConfig returns the default header configuration
@@ -230,34 +371,102 @@ func getDefaultHeaderConfig() *HeaderConfig {
 	}
 }
 
-// loadHeaders loads header configuration from a headers.toml file in the .spray directory
-func loadHeaders(ctx context.Context, store ObjectStore) (*HeaderConfig, error) {
+// loadHeaders loads the header configuration in layers: the defaults, then the server-level
+// headers.toml named by SPRAY_HEADERS_FILE, then the headers.toml file in the .spray directory.
+// Each layer only changes the settings it contains. Warnings about keys no setting uses are
+// returned along with the configuration.
+func loadHeaders(ctx context.Context, store ObjectStore) (*HeaderConfig, []string, error) {
+	headerConfig, warnings, err := serverHeaderConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	configPath := filepath.Join(configDir, headersFile)
 	reader, _, err := store.GetObject(ctx, configPath)
 	if err != nil {
 		if err == storage.ErrObjectNotExist {
-			// No headers file is fine, return default config
-			return getDefaultHeaderConfig(), nil
+			// No headers file is fine, keep the defaults
+			return headerConfig, warnings, nil
 		}
 		// Handle permission errors gracefully - headers are optional
 		if isPermissionError(err) {
 			// Use a generic bucket name for metrics when we don't have access to store the config
 			redirectConfigErrors.WithLabelValues("", "permission_denied").Inc()
 			logStructuredWarning("load_headers", configPath, err)
-			return getDefaultHeaderConfig(), nil
+			return headerConfig, warnings, nil
 		}
 		redirectConfigErrors.WithLabelValues("", "read_error").Inc()
-		return nil, fmt.Errorf("error reading headers file at %s: %v", configPath, err)
+		return nil, nil, fmt.Errorf("error reading headers file at %s: %v", configPath, err)
 	}
 	defer reader.Close()
 
-	var headerConfig HeaderConfig
-	if _, err := toml.NewDecoder(reader).Decode(&headerConfig); err != nil {
+	siteWarnings, err := decodeHeaderLayer(reader, headerConfig, configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if errType, err := validateHeaderConfig(headerConfig, configPath); err != nil {
+		redirectConfigErrors.WithLabelValues("", errType).Inc()
+		return nil, nil, err
+	}
+
+	return headerConfig, append(warnings, siteWarnings...), nil
+}
+
+// serverHeaderConfig returns the default header configuration with the server-level
+// headers.toml named by SPRAY_HEADERS_FILE, if any, applied over it
+func serverHeaderConfig() (*HeaderConfig, []string, error) {
+	headerConfig := getDefaultHeaderConfig()
+	configPath := os.Getenv("SPRAY_HEADERS_FILE")
+	if configPath == "" {
+		return headerConfig, nil, nil
+	}
+
+	file, err := os.Open(configPath)
+	if err != nil {
+		redirectConfigErrors.WithLabelValues("", "read_error").Inc()
+		return nil, nil, fmt.Errorf("error reading server headers file: %v", err)
+	}
+	defer file.Close()
+
+	warnings, err := decodeHeaderLayer(file, headerConfig, configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if errType, err := validateHeaderConfig(headerConfig, configPath); err != nil {
+		redirectConfigErrors.WithLabelValues("", errType).Inc()
+		return nil, nil, err
+	}
+	return headerConfig, warnings, nil
+}
+
+// decodeHeaderLayer decodes a headers.toml file over headerConfig. Only the settings
+// present in the file are changed: scalars and arrays replace those below, while tables
+// are merged key by key.
+func decodeHeaderLayer(reader io.Reader, headerConfig *HeaderConfig, configPath string) ([]string, error) {
+	md, err := toml.NewDecoder(reader).Decode(headerConfig)
+	if err != nil {
 		redirectConfigErrors.WithLabelValues("", "parse_error").Inc()
 		return nil, fmt.Errorf("error parsing headers file at %s: %v", configPath, err)
 	}
+	return checkUnknownKeys(md, configPath)
+}
+
+// validateHeaderConfig checks the values of a decoded headers.toml. On failure it
+// returns the error type recorded in redirectConfigErrors along with the error.
+func validateHeaderConfig(headerConfig *HeaderConfig, configPath string) (string, error) {
+	if !validTrailingSlashPolicies[headerConfig.CleanURLs.TrailingSlash] {
+		return "invalid_value", fmt.Errorf("invalid clean_urls.trailing_slash %q in %s: must be always, never or auto", headerConfig.CleanURLs.TrailingSlash, configPath)
+	}
 
-	return &headerConfig, nil
+	if err := validateHiddenPatterns(headerConfig.Hidden.Patterns); err != nil {
+		return "invalid_pattern", fmt.Errorf("%v in %s", err, configPath)
+	}
+
+	if size := headerConfig.Autoindex.PageSize; size < 0 || size > maxAutoindexPageSize {
+		return "invalid_value", fmt.Errorf("invalid autoindex.page_size %d in %s: must be between 0 and %d (0 = default)", size, configPath, maxAutoindexPageSize)
+	}
+	return "", nil
 }
 
 // loadConfig loads configuration from environment variables and the provided base config.
@@ -272,26 +481,60 @@ func loadConfig(ctx context.Context, base *config, store ObjectStore) (*config,
 	cfg.bucketName = os.Getenv("BUCKET_NAME")
 	cfg.projectID = os.Getenv("GOOGLE_PROJECT_ID")
 	cfg.store = store // Assign the store to the config
+	resolveSource(cfg)
 
 	if err := validateConfig(cfg); err != nil {
 		return nil, err
 	}
 
+	if cfg.adminToken == "" {
+		cfg.adminToken = os.Getenv("SPRAY_ADMIN_TOKEN")
+	}
+
+	if cfg.configEndpoints == "" {
+		cfg.configEndpoints = os.Getenv("SPRAY_CONFIG_ENDPOINTS")
+	}
+	if cfg.configEndpoints == "" {
+		cfg.configEndpoints = configEndpointsPublic
+	}
+	if !validConfigEndpointModes[cfg.configEndpoints] {
+		return nil, fmt.Errorf("invalid SPRAY_CONFIG_ENDPOINTS %q: must be public, protected or disabled", cfg.configEndpoints)
+	}
+	if cfg.configEndpoints == configEndpointsProtected && cfg.adminToken == "" {
+		return nil, fmt.Errorf("SPRAY_CONFIG_ENDPOINTS=protected requires SPRAY_ADMIN_TOKEN")
+	}
+
+	if v := os.Getenv("SPRAY_CONFIG_RELOAD_INTERVAL"); v != "" && cfg.reloadInterval == 0 {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < 0 {
+			return nil, fmt.Errorf("invalid SPRAY_CONFIG_RELOAD_INTERVAL %q: expected a duration such as 30s", v)
+		}
+		cfg.reloadInterval = interval
+	}
+
 	// Load redirects and headers if store is provided
 	if store != nil {
-		redirects, err := loadRedirects(ctx, store)
+		redirects, redirectWarnings, err := loadRedirects(ctx, store)
 		if err != nil {
 			return nil, fmt.Errorf("error loading redirects: %v", err)
 		}
 		cfg.redirects = redirects
 
-		headers, err := loadHeaders(ctx, store)
+		rewrites, err := loadRewrites(ctx, store)
+		if err != nil {
+			return nil, fmt.Errorf("error loading rewrites: %v", err)
+		}
+		cfg.rewrites = rewrites
+
+		headers, headerWarnings, err := loadHeaders(ctx, store)
 		if err != nil {
 			return nil, fmt.Errorf("error loading headers: %v", err)
 		}
 		cfg.headers = headers
+		cfg.configWarnings = append(redirectWarnings, headerWarnings...)
 	} else {
-		cfg.redirects = make(map[string]string)
+		cfg.redirects = make(map[string]RedirectRule)
+		cfg.rewrites = make(map[string]string)
 		cfg.headers = &HeaderConfig{
 			PoweredBy: PoweredByConfig{Enabled: true},
 		}
@@ -172,7 +172,7 @@ func TestLoadRedirects_PermissionError(t *testing.T) {
 	os.Stderr = w
 
 	// Call loadRedirects - should handle permission error gracefully
-	redirects, err := loadRedirects(ctx, store)
+	redirects, _, err := loadRedirects(ctx, store)
 
 	// Close writer and read output
 	w.Close()
@@ -207,13 +207,26 @@ func (s *mockPermissionErrorStore) GetObject(ctx context.Context, path string) (
 	return nil, nil, errors.New("AccessDenied: permission denied to resource")
 }
 
+func (s *mockPermissionErrorStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return s.GetObject(ctx, path)
+}
+
+func (s *mockPermissionErrorStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	_, attrs, err := s.GetObject(ctx, path)
+	return attrs, err
+}
+
+func (s *mockPermissionErrorStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	return nil, "", errors.New("AccessDenied: permission denied to resource")
+}
+
 func TestLoadRedirects_NotFoundError(t *testing.T) {
 	ctx := context.Background()
 
 	// Create a mock store that returns not found error
 	store := &mockNotFoundStore{}
 
-	redirects, err := loadRedirects(ctx, store)
+	redirects, _, err := loadRedirects(ctx, store)
 
 	// Should return empty map and no error when file not found
 	if err != nil {
@@ -235,3 +248,15 @@ type mockNotFoundStore struct{}
 func (s *mockNotFoundStore) GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error) {
 	return nil, nil, storage.ErrObjectNotExist
 }
+
+func (s *mockNotFoundStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return nil, nil, storage.ErrObjectNotExist
+}
+
+func (s *mockNotFoundStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	return nil, storage.ErrObjectNotExist
+}
+
+func (s *mockNotFoundStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	return nil, "", nil
+}
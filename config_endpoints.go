@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// Modes of the configuration endpoints (/config, /config/redirects and /config/headers)
+const (
+	configEndpointsPublic    = "public"    // anyone can read them (default)
+	configEndpointsProtected = "protected" // they require the admin token
+	configEndpointsDisabled  = "disabled"  // they are not registered
+)
+
+// validConfigEndpointModes are the values accepted for SPRAY_CONFIG_ENDPOINTS
+var validConfigEndpointModes = map[string]bool{
+	configEndpointsPublic:    true,
+	configEndpointsProtected: true,
+	configEndpointsDisabled:  true,
+}
+
+// configSource is a configuration object and the version of it in effect
+type configSource struct {
+	Object     string `json:"object"`
+	Generation string `json:"generation,omitempty"` // generation, ETag or modification time; omitted when the object does not exist
+}
+
+// configSources returns the versions of the named configuration files in effect, or nil
+// when they were not recorded
+func (s *gcsServer) configSources(names ...string) []configSource {
+	if s.site == nil || s.site.versions == nil {
+		return nil
+	}
+	sources := make([]configSource, 0, len(names))
+	for _, name := range names {
+		key := filepath.Join(configDir, name)
+		sources = append(sources, configSource{Object: key, Generation: s.site.versions[key]})
+	}
+	return sources
+}
+
+// configLoadedAt returns when the configuration in effect was loaded, or nil when unknown
+func (s *gcsServer) configLoadedAt() *time.Time {
+	if s.site == nil {
+		return nil
+	}
+	return &s.site.loadedAt
+}
+
+// writeConfigJSON writes a configuration endpoint response
+func writeConfigJSON(w http.ResponseWriter, server *gcsServer, endpoint string, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		server.logError(logging.Error, "config_endpoint", endpoint, http.StatusInternalServerError, err)
+	}
+}
+
+// configHeadersHandler returns the header configuration in effect as JSON, with every
+// setting including those left at their defaults
+func configHeadersHandler(live *gcsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server := live.snapshot()
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Method not allowed"))
+			return
+		}
+
+		writeConfigJSON(w, server, "/config/headers", struct {
+			Headers         *HeaderConfig  `json:"headers"`
+			PoweredByHeader string         `json:"powered_by_header"` // X-Powered-By value sent, "" when none
+			ConfigSource    string         `json:"config_source"`
+			Sources         []configSource `json:"sources,omitempty"`
+			LoadedAt        *time.Time     `json:"loaded_at,omitempty"`
+			BucketName      string         `json:"bucket_name"`
+			Warnings        []string       `json:"warnings,omitempty"`
+		}{
+			Headers:         server.headers,
+			PoweredByHeader: resolveXPoweredByHeader(server.headers, Version),
+			ConfigSource:    filepath.Join(configDir, headersFile),
+			Sources:         server.configSources(headersFile),
+			LoadedAt:        server.configLoadedAt(),
+			BucketName:      server.bucketName,
+			Warnings:        server.configWarnings(),
+		})
+	}
+}
+
+// configHandler returns the whole configuration in effect as JSON
+func configHandler(live *gcsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server := live.snapshot()
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			w.Write([]byte("Method not allowed"))
+			return
+		}
+
+		var rewrites map[string]string
+		if server.site != nil {
+			rewrites = server.site.rewriteRules
+		}
+		writeConfigJSON(w, server, "/config", struct {
+			Redirects  map[string]RedirectRule `json:"redirects"`
+			Rewrites   map[string]string       `json:"rewrites"`
+			Headers    *HeaderConfig           `json:"headers"`
+			Sources    []configSource          `json:"sources,omitempty"`
+			LoadedAt   *time.Time              `json:"loaded_at,omitempty"`
+			BucketName string                  `json:"bucket_name"`
+			Warnings   []string                `json:"warnings,omitempty"`
+		}{
+			Redirects:  server.redirects,
+			Rewrites:   rewrites,
+			Headers:    server.headers,
+			Sources:    server.configSources(configFiles...),
+			LoadedAt:   server.configLoadedAt(),
+			BucketName: server.bucketName,
+			Warnings:   server.configWarnings(),
+		})
+	}
+}
+
+// serveConfigEndpoints registers the configuration endpoints, keyed by path, as selected
+// by mode: openly, behind the admin token or not at all
+func serveConfigEndpoints(mux *http.ServeMux, mode, adminToken string, endpoints map[string]http.HandlerFunc) {
+	if mode == configEndpointsDisabled {
+		return
+	}
+	for path, handler := range endpoints {
+		if mode == configEndpointsProtected {
+			handler = requireAdminToken(adminToken, handler)
+		}
+		mux.HandleFunc(path, handler)
+	}
+}
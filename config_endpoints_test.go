@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newConfigEndpointsServer serves a temporary site through createServer with the given
+// configuration files and endpoint mode
+func newConfigEndpointsServer(t *testing.T, files map[string]string, mode, adminToken string) http.Handler {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		writeTestFile(t, root, name, content)
+	}
+	store, err := newFileObjectStore(root)
+	require.NoError(t, err)
+
+	site, err := loadSiteConfig(context.Background(), store)
+	require.NoError(t, err)
+	srv, err := createServer(t.Context(), &config{
+		port:            "8080",
+		bucketName:      "config-bucket",
+		store:           store,
+		redirects:       site.redirects,
+		rewrites:        site.rewriteRules,
+		headers:         site.headers,
+		configEndpoints: mode,
+		adminToken:      adminToken,
+	}, newMockLogClient())
+	require.NoError(t, err)
+	return srv.Handler
+}
+
+func getConfig(handler http.Handler, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestConfigHeadersEndpoint(t *testing.T) {
+	t.Setenv("SPRAY_POWERED_BY_HEADER", "spray-test")
+	handler := newConfigEndpointsServer(t, map[string]string{
+		".spray/headers.toml": "[powered_by]\nenabled = true\n[cache]\nenabled = true\n[cache.rollout]\nenabled = true\npercentage = 25\n",
+	}, "", "")
+
+	rr := getConfig(handler, "/config/headers", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var body struct {
+		Headers         HeaderConfig   `json:"headers"`
+		PoweredByHeader string         `json:"powered_by_header"`
+		ConfigSource    string         `json:"config_source"`
+		Sources         []configSource `json:"sources"`
+		LoadedAt        time.Time      `json:"loaded_at"`
+		BucketName      string         `json:"bucket_name"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+	assert.True(t, body.Headers.Cache.Enabled)
+	assert.True(t, body.Headers.Cache.RolloutConfig.Enabled)
+	assert.Equal(t, 25, body.Headers.Cache.RolloutConfig.Percentage)
+	assert.Equal(t, "spray-test", body.PoweredByHeader)
+	assert.Equal(t, ".spray/headers.toml", body.ConfigSource)
+	require.Len(t, body.Sources, 1)
+	assert.Equal(t, ".spray/headers.toml", body.Sources[0].Object)
+	assert.NotEmpty(t, body.Sources[0].Generation)
+	assert.WithinDuration(t, time.Now(), body.LoadedAt, time.Minute)
+	assert.Equal(t, "config-bucket", body.BucketName)
+
+	t.Run("uses toml key names", func(t *testing.T) {
+		raw := getConfig(handler, "/config/headers", "").Body.String()
+		assert.Contains(t, raw, `"rollout":{"enabled":true,"percentage":25`)
+		assert.Contains(t, raw, `"clean_urls":{"enabled":false,"trailing_slash":""}`)
+	})
+
+	t.Run("get only", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/config/headers", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
+
+func TestConfigEndpoint(t *testing.T) {
+	handler := newConfigEndpointsServer(t, map[string]string{
+		".spray/redirects.toml": "[redirects]\n\"/old\" = { to = \"/new\", status = 301 }\n",
+		".spray/rewrites.toml":  "[rewrites]\n\"/app/*\" = \"app/index.html\"\n",
+	}, "", "")
+
+	rr := getConfig(handler, "/config", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var body struct {
+		Redirects map[string]RedirectRule `json:"redirects"`
+		Rewrites  map[string]string       `json:"rewrites"`
+		Headers   *HeaderConfig           `json:"headers"`
+		Sources   []configSource          `json:"sources"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+	assert.Equal(t, map[string]RedirectRule{"old": {To: "/new", Status: 301}}, body.Redirects)
+	assert.Equal(t, map[string]string{"app/*": "app/index.html"}, body.Rewrites)
+	require.NotNil(t, body.Headers)
+	assert.Equal(t, 300, body.Headers.Cache.Policies.ShortMaxAge, "defaults are included")
+
+	require.Len(t, body.Sources, 3)
+	generations := make(map[string]string)
+	for _, source := range body.Sources {
+		generations[source.Object] = source.Generation
+	}
+	assert.NotEmpty(t, generations[".spray/redirects.toml"])
+	assert.NotEmpty(t, generations[".spray/rewrites.toml"])
+	assert.Empty(t, generations[".spray/headers.toml"], "missing objects have no generation")
+}
+
+func TestConfigEndpoints_Modes(t *testing.T) {
+	paths := []string{"/config", "/config/redirects", "/config/headers"}
+
+	t.Run("protected", func(t *testing.T) {
+		handler := newConfigEndpointsServer(t, map[string]string{}, configEndpointsProtected, "secret")
+		for _, path := range paths {
+			assert.Equal(t, http.StatusUnauthorized, getConfig(handler, path, "").Code, path)
+			assert.Equal(t, http.StatusUnauthorized, getConfig(handler, path, "wrong").Code, path)
+			assert.Equal(t, http.StatusOK, getConfig(handler, path, "secret").Code, path)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		handler := newConfigEndpointsServer(t, map[string]string{}, configEndpointsDisabled, "")
+		for _, path := range paths {
+			assert.Equal(t, http.StatusNotFound, getConfig(handler, path, "").Code, path)
+		}
+	})
+}
+
+func TestLoadConfig_ConfigEndpoints(t *testing.T) {
+	t.Setenv("BUCKET_NAME", "test-bucket")
+	t.Setenv("GOOGLE_PROJECT_ID", "test-project")
+
+	cfg, err := loadConfig(context.Background(), &config{port: "8080"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, configEndpointsPublic, cfg.configEndpoints)
+
+	t.Setenv("SPRAY_CONFIG_ENDPOINTS", "disabled")
+	cfg, err = loadConfig(context.Background(), &config{port: "8080"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, configEndpointsDisabled, cfg.configEndpoints)
+
+	cfg, err = loadConfig(context.Background(), &config{port: "8080", configEndpoints: configEndpointsPublic}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, configEndpointsPublic, cfg.configEndpoints, "the flag wins over the environment")
+
+	t.Setenv("SPRAY_CONFIG_ENDPOINTS", "secret")
+	_, err = loadConfig(context.Background(), &config{port: "8080"}, nil)
+	assert.Error(t, err)
+
+	t.Setenv("SPRAY_CONFIG_ENDPOINTS", "protected")
+	_, err = loadConfig(context.Background(), &config{port: "8080"}, nil)
+	assert.Error(t, err, "protecting the endpoints requires the admin token")
+
+	t.Setenv("SPRAY_ADMIN_TOKEN", "token")
+	_, err = loadConfig(context.Background(), &config{port: "8080"}, nil)
+	assert.NoError(t, err)
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -103,3 +107,80 @@ func TestLoadConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadHeaders_UnknownKeys(t *testing.T) {
+	store := &mockHeaderStore{content: "[cache.rollout]\npercentag = 50\n[powered_by]\nenabled = false\n[typo_section]\nkey = 1\n"}
+	before := testutil.ToFloat64(configUnknownKeys.WithLabelValues(".spray/headers.toml"))
+
+	headers, warnings, err := loadHeaders(context.Background(), store)
+	require.NoError(t, err)
+	assert.False(t, headers.PoweredBy.Enabled, "known keys still apply")
+	assert.Equal(t, []string{
+		`unknown key "cache.rollout.percentag" in .spray/headers.toml is ignored`,
+		`unknown key "typo_section" in .spray/headers.toml is ignored`,
+	}, warnings)
+	assert.Equal(t, before+2, testutil.ToFloat64(configUnknownKeys.WithLabelValues(".spray/headers.toml")))
+
+	t.Setenv("SPRAY_STRICT_CONFIG", "true")
+	_, _, err = loadHeaders(context.Background(), store)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cache.rollout.percentag, typo_section")
+}
+
+func TestLoadRedirects_UnknownKeys(t *testing.T) {
+	store := &mockRedirectStore{content: "[redirect]\n\"/a\" = \"/b\"\n[redirects]\n\"/c\" = \"/d\"\n"}
+
+	redirects, warnings, err := loadRedirects(context.Background(), store)
+	require.NoError(t, err)
+	assert.Len(t, redirects, 1)
+	assert.Equal(t, []string{`unknown key "redirect" in .spray/redirects.toml is ignored`}, warnings)
+
+	_, warnings, err = loadRedirects(context.Background(), &mockRedirectStore{content: "[redirects]\n\"/c\" = \"/d\"\n"})
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	t.Setenv("SPRAY_STRICT_CONFIG", "true")
+	_, _, err = loadRedirects(context.Background(), store)
+	assert.Error(t, err)
+}
+
+func TestConfigWarnings_Endpoint(t *testing.T) {
+	server, root := newReloadableServer(t, "warnings-bucket", map[string]string{
+		".spray/headers.toml": "[spa]\nenabeld = true\n",
+	})
+	assert.Equal(t, []string{`unknown key "spa.enabeld" in .spray/headers.toml is ignored`}, server.configWarnings())
+
+	configWarnings := func() []string {
+		rr := httptest.NewRecorder()
+		configRedirectsHandler(server)(rr, httptest.NewRequest(http.MethodGet, "/config/redirects", nil))
+		var body struct {
+			Warnings []string `json:"warnings"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+		return body.Warnings
+	}
+
+	writeTestFile(t, root, ".spray/headers.toml", "[spa]\nenabled = true\n")
+	_, _, err := server.reloadConfig(context.Background(), false)
+	require.NoError(t, err)
+	assert.Empty(t, configWarnings(), "fixing the file clears the warning")
+
+	writeTestFile(t, root, ".spray/redirects.toml", "default_status = 301\n[redirects]\n\"/a\" = \"/b\"\n")
+	_, _, err = server.reloadConfig(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`unknown key "default_status" in .spray/redirects.toml is ignored`}, configWarnings())
+}
+
+func TestLoadConfig_ConfigWarnings(t *testing.T) {
+	t.Setenv("BUCKET_NAME", "test-bucket")
+	t.Setenv("GOOGLE_PROJECT_ID", "test-project")
+	cfg, err := loadConfig(context.Background(), &config{port: "8080"}, &mockHeaderStore{content: "[powered_by]\nenable = false\n"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{`unknown key "powered_by.enable" in .spray/headers.toml is ignored`}, cfg.configWarnings)
+
+	srv, err := createServer(t.Context(), cfg, newMockLogClient())
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/config/redirects", nil))
+	assert.Contains(t, rr.Body.String(), `powered_by.enable`)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// maxErrorPageDirs is the number of directories above the requested path searched for an
+// error page before the bucket root, so deep paths cannot multiply backend calls
+const maxErrorPageDirs = 2
+
+// errorPageCandidates returns the object keys checked for a custom error page, nearest
+// directory first: "docs/guide/page.html" with 404 gives docs/guide/404.html,
+// docs/404.html and 404.html. Only the nearest maxErrorPageDirs directories are tried.
+func errorPageCandidates(requestPath string, statusCode int) []string {
+	page := strconv.Itoa(statusCode) + ".html"
+	dir := path.Dir(strings.Trim(requestPath, "/"))
+
+	// Paths rejected by cleanRequestPath only get the bucket-wide page
+	if strings.Contains(requestPath, "..") {
+		dir = "."
+	}
+
+	var candidates []string
+	for dir != "." && dir != "/" && dir != "" && len(candidates) < maxErrorPageDirs {
+		candidates = append(candidates, dir+"/"+page)
+		dir = path.Dir(dir)
+	}
+	return append(candidates, page)
+}
+
+// serveErrorPage serves a custom error page such as 404.html from the bucket with
+// the given status code. It returns false when the bucket has no matching page.
+func (s *gcsServer) serveErrorPage(w http.ResponseWriter, r *http.Request, requestPath string, statusCode int) bool {
+	if s.store == nil {
+		return false
+	}
+	ctx := r.Context()
+
+	for _, candidate := range errorPageCandidates(requestPath, statusCode) {
+		// The page for a missing object must not be the missing object itself, and hidden
+		// objects such as .spray/404.html are never served as error pages either
+		if candidate == requestPath || s.hiddenReason(candidate) != "" {
+			continue
+		}
+
+		// Check that the page exists before opening it; most candidates are missing
+		gcsStart := time.Now()
+		attrs, err := s.store.GetObjectAttrs(ctx, candidate)
+		gcsLatency.WithLabelValues(s.bucketName, "get_error_page_attrs").Observe(time.Since(gcsStart).Seconds())
+		if err != nil {
+			// Missing or unreadable pages fall back to the next candidate
+			continue
+		}
+
+		var reader io.ReadCloser
+		if r.Method != http.MethodHead {
+			gcsStart = time.Now()
+			reader, _, err = s.store.GetObject(ctx, candidate)
+			gcsLatency.WithLabelValues(s.bucketName, "get_error_page").Observe(time.Since(gcsStart).Seconds())
+			if err != nil {
+				continue
+			}
+			defer reader.Close()
+		}
+
+		contentType := "text/html; charset=utf-8"
+		if attrs != nil && attrs.ContentType != "" {
+			contentType = attrs.ContentType
+		}
+		w.Header().Set("Content-Type", contentType)
+		if attrs != nil && attrs.Size > 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(attrs.Size, 10))
+		}
+		w.WriteHeader(statusCode)
+		customErrorPages.WithLabelValues(s.bucketName, strconv.Itoa(statusCode)).Inc()
+
+		if reader != nil {
+			if _, err := io.Copy(w, reader); err != nil {
+				s.logError(logging.Warning, "serve_error_page", candidate, statusCode, err)
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorPageCandidates(t *testing.T) {
+	assert.Equal(t, []string{"docs/guide/404.html", "docs/404.html", "404.html"}, errorPageCandidates("docs/guide/page.html", 404))
+	assert.Equal(t, []string{"404.html"}, errorPageCandidates("missing.html", 404))
+	assert.Equal(t, []string{"500.html"}, errorPageCandidates("/index.html", 500))
+	assert.Equal(t, []string{"400.html"}, errorPageCandidates("/docs/../../etc/passwd", 400))
+	assert.Equal(t, []string{"a/b/c/404.html", "a/b/404.html", "404.html"}, errorPageCandidates("a/b/c/d.html", 404), "only the nearest directories are tried")
+}
+
+func TestServeErrorPage_BackendCalls(t *testing.T) {
+	store := &backendCallStore{mockObjectStore: mockObjectStore{objects: map[string]mockObject{
+		"404.html": {data: []byte("site not found page"), contentType: "text/html"},
+	}}}
+	server := &gcsServer{store: store, bucketName: "error-pages-calls", logger: &mockLogger{}}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/"+strings.Repeat("d/", 200)+"missing.html", nil)
+	require.True(t, server.serveErrorPage(rr, req, strings.Repeat("d/", 200)+"missing.html", http.StatusNotFound))
+	assert.Equal(t, "site not found page", rr.Body.String())
+	assert.Equal(t, int32(maxErrorPageDirs+1), store.attrsReads.Load(), "one metadata lookup per candidate")
+	assert.Equal(t, int32(1), store.objectReads.Load(), "only the page found is opened")
+}
+
+func TestServeHTTP_CustomErrorPages(t *testing.T) {
+	const bucket = "error-pages-bucket"
+	objects := map[string]mockObject{
+		"index.html":     {data: []byte("home"), contentType: "text/html"},
+		"404.html":       {data: []byte("site not found page"), contentType: "text/html; charset=utf-8"},
+		"docs/404.html":  {data: []byte("docs not found page"), contentType: "text/html"},
+		"docs/page.html": {data: []byte("docs"), contentType: "text/html"},
+	}
+	server := &gcsServer{
+		store:      &mockObjectStore{objects: objects},
+		bucketName: bucket,
+		logger:     &mockLogger{},
+		headers:    getDefaultHeaderConfig(),
+	}
+
+	serve := func(method, path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("bucket-wide page", func(t *testing.T) {
+		before := testutil.ToFloat64(customErrorPages.WithLabelValues(bucket, "404"))
+		rr := serve(http.MethodGet, "/missing.html", "text/html")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, "site not found page", rr.Body.String())
+		assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Equal(t, before+1, testutil.ToFloat64(customErrorPages.WithLabelValues(bucket, "404")))
+	})
+
+	t.Run("per-directory override", func(t *testing.T) {
+		for _, path := range []string{"/docs/missing.html", "/docs/guide/missing"} {
+			rr := serve(http.MethodGet, path, "text/html")
+			assert.Equal(t, http.StatusNotFound, rr.Code, path)
+			assert.Equal(t, "docs not found page", rr.Body.String(), path)
+		}
+	})
+
+	t.Run("HEAD sends no body", func(t *testing.T) {
+		rr := serve(http.MethodHead, "/missing.html", "text/html")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Empty(t, rr.Body.String())
+	})
+
+	t.Run("built-in page without a custom page", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/docs/../secret", "text/html")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Error 400")
+	})
+
+	t.Run("JSON clients are unchanged", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/missing.html", "application/json")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var body errorResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+		assert.Equal(t, http.StatusNotFound, body.Status)
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"syscall"
+
+	"cloud.google.com/go/storage"
+)
+
+// FileObjectStore implements ObjectStore on top of a local directory
+type FileObjectStore struct {
+	root string
+}
+
+// newFileObjectStore creates a FileObjectStore rooted at the given directory
+func newFileObjectStore(root string) (*FileObjectStore, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("cannot access source directory %s: %v", root, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("source %s is not a directory", root)
+	}
+	return &FileObjectStore{root: root}, nil
+}
+
+// resolve maps an object key to a file path that is guaranteed to stay inside the root
+func (s *FileObjectStore) resolve(key string) string {
+	// Object keys always use forward slashes; cleaning against "/" strips any
+	// ".." elements before the key is joined onto the root directory
+	cleaned := path.Clean("/" + filepath.ToSlash(key))
+	return filepath.Join(s.root, filepath.FromSlash(cleaned))
+}
+
+// GetObject opens a file below the root directory
+func (s *FileObjectStore) GetObject(ctx context.Context, key string) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	file, err := os.Open(s.resolve(key))
+	if err != nil {
+		return nil, nil, translateFileError(err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, translateFileError(err)
+	}
+
+	// Directories are not objects; index handling happens in cleanRequestPath
+	if info.IsDir() {
+		file.Close()
+		return nil, nil, storage.ErrObjectNotExist
+	}
+
+	contentType, err := detectFileContentType(key, file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return file, fileObjectAttrs(key, info, contentType), nil
+}
+
+// GetObjectRange opens a file and positions it at offset, limiting reads to length bytes
+func (s *FileObjectStore) GetObjectRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	reader, attrs, err := s.GetObject(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file := reader.(*os.File)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("error seeking %s: %v", key, err)
+	}
+	if length < 0 {
+		return file, attrs, nil
+	}
+	return &rangeReadCloser{Reader: io.LimitReader(file, length), Closer: file}, attrs, nil
+}
+
+// GetObjectAttrs returns file metadata; the file is only read when its content type must be sniffed
+func (s *FileObjectStore) GetObjectAttrs(ctx context.Context, key string) (*storage.ObjectAttrs, error) {
+	reader, attrs, err := s.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	reader.Close()
+	return attrs, nil
+}
+
+// ListObjects reads the directory matching prefix. Content types are derived from file
+// extensions only, so listing does not open every file.
+func (s *FileObjectStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	dir := s.resolve(prefix)
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, "", translateFileError(err)
+	}
+
+	var entries []*storage.ObjectAttrs
+	for _, entry := range dirEntries {
+		key := prefix + entry.Name()
+		// Stat follows symlinks, matching what GetObject serves
+		info, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			entries = append(entries, &storage.ObjectAttrs{Prefix: key + "/"})
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		entries = append(entries, fileObjectAttrs(key, info, mime.TypeByExtension(filepath.Ext(key))))
+	}
+	sort.Slice(entries, func(i, j int) bool { return listEntryKey(entries[i]) < listEntryKey(entries[j]) })
+
+	entries, next := paginateListing(entries, pageToken, limit)
+	return entries, next, nil
+}
+
+// fileObjectAttrs builds the storage attributes spray uses from file metadata
+func fileObjectAttrs(key string, info fs.FileInfo, contentType string) *storage.ObjectAttrs {
+	return &storage.ObjectAttrs{
+		Name:        key,
+		ContentType: contentType,
+		Size:        info.Size(),
+		Updated:     info.ModTime(),
+	}
+}
+
+// detectFileContentType determines the content type from the file extension,
+// falling back to sniffing the first bytes of the file
+func detectFileContentType(key string, file *os.File) (string, error) {
+	if contentType := mime.TypeByExtension(filepath.Ext(key)); contentType != "" {
+		return contentType, nil
+	}
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("error reading %s: %v", key, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("error rewinding %s: %v", key, err)
+	}
+
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// translateFileError maps filesystem errors onto the errors spray expects from storage backends
+func translateFileError(err error) error {
+	// A path component that is a regular file surfaces as ENOTDIR rather than ENOENT
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return storage.ErrObjectNotExist
+	}
+	return err
+}
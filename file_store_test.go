@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestFile creates a file below root, including parent directories
+func writeTestFile(t *testing.T, root, name, content string) {
+	t.Helper()
+	fullPath := filepath.Join(root, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0o755))
+	require.NoError(t, os.WriteFile(fullPath, []byte(content), 0o644))
+}
+
+func TestFileObjectStore_GetObject(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "index.html", "<html><body>Home</body></html>")
+	writeTestFile(t, root, "css/site.css", "body { color: red; }")
+	writeTestFile(t, root, "LICENSE", "plain license text")
+
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "index.html"), modTime, modTime))
+
+	store, err := newFileObjectStore(root)
+	require.NoError(t, err)
+
+	t.Run("existing file", func(t *testing.T) {
+		reader, attrs, err := store.GetObject(context.Background(), "index.html")
+		require.NoError(t, err)
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, "<html><body>Home</body></html>", string(data))
+		assert.Equal(t, "index.html", attrs.Name)
+		assert.Equal(t, int64(len(data)), attrs.Size)
+		assert.True(t, attrs.Updated.Equal(modTime))
+		assert.Contains(t, attrs.ContentType, "text/html")
+	})
+
+	t.Run("nested file", func(t *testing.T) {
+		reader, attrs, err := store.GetObject(context.Background(), "css/site.css")
+		require.NoError(t, err)
+		defer reader.Close()
+		assert.Contains(t, attrs.ContentType, "text/css")
+	})
+
+	t.Run("content type sniffed without extension", func(t *testing.T) {
+		reader, attrs, err := store.GetObject(context.Background(), "LICENSE")
+		require.NoError(t, err)
+		defer reader.Close()
+
+		// Sniffing must not consume the start of the file
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, "plain license text", string(data))
+		assert.Contains(t, attrs.ContentType, "text/plain")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		reader, attrs, err := store.GetObject(context.Background(), "missing.html")
+		assert.Equal(t, storage.ErrObjectNotExist, err)
+		assert.Nil(t, reader)
+		assert.Nil(t, attrs)
+	})
+
+	t.Run("directory is not an object", func(t *testing.T) {
+		_, _, err := store.GetObject(context.Background(), "css")
+		assert.Equal(t, storage.ErrObjectNotExist, err)
+	})
+
+	t.Run("file used as directory", func(t *testing.T) {
+		_, _, err := store.GetObject(context.Background(), "index.html/child")
+		assert.Equal(t, storage.ErrObjectNotExist, err)
+	})
+
+	t.Run("traversal stays inside root", func(t *testing.T) {
+		outside := filepath.Join(filepath.Dir(root), "outside.txt")
+		require.NoError(t, os.WriteFile(outside, []byte("secret"), 0o644))
+		defer os.Remove(outside)
+
+		_, _, err := store.GetObject(context.Background(), "../outside.txt")
+		assert.Equal(t, storage.ErrObjectNotExist, err)
+	})
+}
+
+func TestNewFileObjectStore_Errors(t *testing.T) {
+	_, err := newFileObjectStore(filepath.Join(t.TempDir(), "does-not-exist"))
+	assert.Error(t, err)
+
+	file := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(file, []byte("x"), 0o644))
+	_, err = newFileObjectStore(file)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a directory")
+}
+
+func TestFileObjectStore_LoadsSprayConfig(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, ".spray/redirects.toml", "[redirects]\n\"/old\" = \"https://example.com/new\"\n")
+	writeTestFile(t, root, ".spray/headers.toml", "[powered_by]\nenabled = false\n")
+
+	store, err := newFileObjectStore(root)
+	require.NoError(t, err)
+
+	redirects, _, err := loadRedirects(context.Background(), store)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]RedirectRule{"old": {To: "https://example.com/new"}}, redirects)
+
+	headers, _, err := loadHeaders(context.Background(), store)
+	require.NoError(t, err)
+	assert.False(t, headers.PoweredBy.Enabled)
+}
+
+func TestFileObjectStore_ServeHTTP(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "index.html", "<h1>Local</h1>")
+	writeTestFile(t, root, "docs/index.html", "<h1>Docs</h1>")
+
+	store, err := newFileObjectStore(root)
+	require.NoError(t, err)
+
+	server, err := newGCSServer(context.Background(), root, &mockLogger{}, store, nil, nil, getDefaultHeaderConfig())
+	require.NoError(t, err)
+
+	tests := []struct {
+		path         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"/", http.StatusOK, "<h1>Local</h1>"},
+		{"/docs/", http.StatusOK, "<h1>Docs</h1>"},
+		{"/missing.html", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+				assert.Contains(t, rr.Header().Get("Content-Type"), "text/html")
+			}
+		})
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected sourceSpec
+		wantErr  bool
+	}{
+		{name: "empty defaults to GCS", raw: "", expected: sourceSpec{scheme: "gs"}},
+		{name: "GCS bucket", raw: "gs://my-bucket", expected: sourceSpec{scheme: "gs", location: "my-bucket"}},
+		{name: "absolute directory", raw: "file:///srv/site", expected: sourceSpec{scheme: "file", location: "/srv/site"}},
+		{name: "relative directory", raw: "file://./public", expected: sourceSpec{scheme: "file", location: "./public"}},
+		{name: "missing scheme", raw: "/srv/site", wantErr: true},
+		{name: "unknown scheme", raw: "ftp://host/site", wantErr: true},
+		{name: "GCS bucket with path", raw: "gs://bucket/prefix", wantErr: true},
+		{name: "empty directory", raw: "file://", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := parseSource(tt.raw)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, spec)
+		})
+	}
+}
+
+func TestLoadConfig_FileSource(t *testing.T) {
+	root := t.TempDir()
+
+	t.Setenv("BUCKET_NAME", "")
+	t.Setenv("GOOGLE_PROJECT_ID", "")
+	t.Setenv("SPRAY_SOURCE", "file://"+root)
+
+	cfg, err := loadConfig(context.Background(), &config{port: "8080"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "file://"+root, cfg.source)
+	assert.Equal(t, root, cfg.bucketName, "directory is used as the bucket label when BUCKET_NAME is unset")
+
+	// An explicit source on the base config wins over the environment
+	cfg, err = loadConfig(context.Background(), &config{port: "8080", source: "gs://flag-bucket"}, nil)
+	assert.Error(t, err, "GCS sources still require a project ID")
+	assert.Nil(t, cfg)
+
+	t.Setenv("GOOGLE_PROJECT_ID", "test-project")
+	cfg, err = loadConfig(context.Background(), &config{port: "8080", source: "gs://flag-bucket"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "flag-bucket", cfg.bucketName)
+}
+
+func TestCreateObjectStore_FileSource(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "index.html", "hello")
+
+	store, closeStore, err := createObjectStore(context.Background(), &config{source: "file://" + root})
+	require.NoError(t, err)
+	defer closeStore()
+
+	_, ok := store.(*FileObjectStore)
+	assert.True(t, ok)
+
+	_, _, err = createObjectStore(context.Background(), &config{source: "file://" + filepath.Join(root, "missing")})
+	assert.Error(t, err)
+}
+
+func TestFileObjectStore_GetObjectRange(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "data.bin", "0123456789")
+
+	store, err := newFileObjectStore(root)
+	require.NoError(t, err)
+
+	reader, attrs, err := store.GetObjectRange(context.Background(), "data.bin", 3, 4)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	reader.Close()
+	assert.Equal(t, "3456", string(data))
+	assert.Equal(t, int64(10), attrs.Size)
+
+	reader, _, err = store.GetObjectRange(context.Background(), "data.bin", 8, -1)
+	require.NoError(t, err)
+	data, _ = io.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, "89", string(data))
+
+	_, _, err = store.GetObjectRange(context.Background(), "missing.bin", 0, 1)
+	assert.Equal(t, storage.ErrObjectNotExist, err)
+}
+
+func TestFileObjectStore_GetObjectAttrs(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "page.html", "<p>hi</p>")
+
+	store, err := newFileObjectStore(root)
+	require.NoError(t, err)
+
+	attrs, err := store.GetObjectAttrs(context.Background(), "page.html")
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), attrs.Size)
+	assert.Contains(t, attrs.ContentType, "text/html")
+
+	_, err = store.GetObjectAttrs(context.Background(), "missing.html")
+	assert.Equal(t, storage.ErrObjectNotExist, err)
+}
+
+func TestFileObjectStore_ListObjects(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "downloads/b.zip", "bb")
+	writeTestFile(t, root, "downloads/a.zip", "a")
+	writeTestFile(t, root, "downloads/v1/x.zip", "x")
+
+	store, err := newFileObjectStore(root)
+	require.NoError(t, err)
+
+	entries, next, err := store.ListObjects(context.Background(), "downloads/", "", 2)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "downloads/a.zip", entries[0].Name)
+	assert.Equal(t, int64(1), entries[0].Size)
+	assert.Equal(t, "application/zip", entries[0].ContentType)
+	assert.False(t, entries[0].Updated.IsZero())
+	assert.Equal(t, "downloads/b.zip", next)
+
+	entries, next, err = store.ListObjects(context.Background(), "downloads/", next, 2)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "downloads/v1/", entries[0].Prefix)
+	assert.Empty(t, next)
+
+	_, _, err = store.ListObjects(context.Background(), "missing/", "", 10)
+	assert.Equal(t, storage.ErrObjectNotExist, err)
+}
@@ -30,7 +30,26 @@ func (m *mockHeaderStore) GetObject(ctx context.Context, path string) (io.ReadCl
 	return nil, nil, storage.ErrObjectNotExist
 }
 
+func (m *mockHeaderStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return getObjectRangeFromFull(m, ctx, path, offset, length)
+}
+
+func (m *mockHeaderStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	return getObjectAttrsFromFull(m, ctx, path)
+}
+
+func (m *mockHeaderStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	return nil, "", nil
+}
+
 func TestLoadHeaders(t *testing.T) {
+	// defaultsWith returns the default configuration with the settings of a file applied
+	defaultsWith := func(apply func(*HeaderConfig)) *HeaderConfig {
+		headers := getDefaultHeaderConfig()
+		apply(headers)
+		return headers
+	}
+
 	tests := []struct {
 		name          string
 		content       string
@@ -38,19 +57,15 @@ func TestLoadHeaders(t *testing.T) {
 		expectedError bool
 	}{
 		{
-			name:    "valid_headers_disabled",
-			content: "[powered_by]\nenabled = false",
-			expected: &HeaderConfig{
-				PoweredBy: PoweredByConfig{Enabled: false},
-			},
+			name:          "valid_headers_disabled",
+			content:       "[powered_by]\nenabled = false",
+			expected:      defaultsWith(func(h *HeaderConfig) { h.PoweredBy.Enabled = false }),
 			expectedError: false,
 		},
 		{
-			name:    "valid_headers_enabled",
-			content: "[powered_by]\nenabled = true",
-			expected: &HeaderConfig{
-				PoweredBy: PoweredByConfig{Enabled: true},
-			},
+			name:          "valid_headers_enabled",
+			content:       "[powered_by]\nenabled = true",
+			expected:      getDefaultHeaderConfig(),
 			expectedError: false,
 		},
 		{
@@ -60,19 +75,15 @@ func TestLoadHeaders(t *testing.T) {
 			expectedError: true,
 		},
 		{
-			name:    "empty_file",
-			content: "",
-			expected: &HeaderConfig{
-				PoweredBy: PoweredByConfig{Enabled: false}, // Default value when not specified
-			},
+			name:          "empty_file",
+			content:       "",
+			expected:      getDefaultHeaderConfig(), // Settings not specified keep their defaults
 			expectedError: false,
 		},
 		{
-			name:    "partial_config",
-			content: "# No powered_by section",
-			expected: &HeaderConfig{
-				PoweredBy: PoweredByConfig{Enabled: false}, // Default value when not specified
-			},
+			name:          "partial_config",
+			content:       "# No powered_by section",
+			expected:      getDefaultHeaderConfig(), // Settings not specified keep their defaults
 			expectedError: false,
 		},
 	}
@@ -80,7 +91,7 @@ func TestLoadHeaders(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			store := &mockHeaderStore{content: tt.content}
-			headers, err := loadHeaders(context.Background(), store)
+			headers, _, err := loadHeaders(context.Background(), store)
 
 			if tt.expectedError {
 				assert.Error(t, err)
@@ -96,7 +107,7 @@ func TestLoadHeaders(t *testing.T) {
 func TestLoadHeaders_FileNotExists(t *testing.T) {
 	// Test when headers.toml doesn't exist - should return default config (enabled)
 	store := &mockObjectStore{objects: make(map[string]mockObject)}
-	headers, err := loadHeaders(context.Background(), store)
+	headers, _, err := loadHeaders(context.Background(), store)
 
 	assert.NoError(t, err)
 	expected := getDefaultHeaderConfig()
@@ -197,7 +208,7 @@ func TestLoadHeaders_PermissionError(t *testing.T) {
 	os.Stderr = w
 
 	// Call loadHeaders - should handle permission error gracefully
-	headers, err := loadHeaders(ctx, store)
+	headers, _, err := loadHeaders(ctx, store)
 
 	// Close writer and read output
 	w.Close()
@@ -285,7 +296,7 @@ func TestXPoweredByHeaderIntegration(t *testing.T) {
 			server := &gcsServer{
 				store:      store,
 				bucketName: "test-bucket",
-				redirects:  make(map[string]string),
+				redirects:  make(map[string]RedirectRule),
 				headers:    tt.headerConfig,
 				logger:     &mockLogger{},
 			}
@@ -308,3 +319,96 @@ func TestXPoweredByHeaderIntegration(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadHeaders_MergesDefaults(t *testing.T) {
+	load := func(content string) *HeaderConfig {
+		headers, _, err := loadHeaders(context.Background(), &mockHeaderStore{content: content})
+		assert.NoError(t, err)
+		return headers
+	}
+
+	t.Run("unrelated sections keep their defaults", func(t *testing.T) {
+		headers := load("[powered_by]\nenabled = false\n")
+		assert.False(t, headers.PoweredBy.Enabled)
+		assert.Equal(t, getDefaultHeaderConfig().Cache, headers.Cache)
+	})
+
+	t.Run("tables merge key by key", func(t *testing.T) {
+		headers := load("[cache]\nenabled = true\n[cache.policies]\nshort_max_age = 60\n")
+		assert.True(t, headers.Cache.Enabled)
+		assert.True(t, headers.Cache.ETag.Enabled)
+		assert.Equal(t, CachePolicyConfig{ShortMaxAge: 60, MediumMaxAge: 86400, LongMaxAge: 31536000}, headers.Cache.Policies)
+	})
+
+	t.Run("explicit zero values override defaults", func(t *testing.T) {
+		headers := load("[cache.etag]\nenabled = false\n[cache.policies]\nlong_max_age = 0\n")
+		assert.False(t, headers.Cache.ETag.Enabled)
+		assert.Equal(t, 0, headers.Cache.Policies.LongMaxAge)
+		assert.Equal(t, 300, headers.Cache.Policies.ShortMaxAge)
+	})
+}
+
+func TestLoadHeaders_ServerLayer(t *testing.T) {
+	dir := t.TempDir()
+	serverFile := filepath.Join(dir, "headers.toml")
+	writeTestFile(t, dir, "headers.toml", `
+[cache]
+enabled = true
+[cache.rollout]
+path_prefixes = ["/static/"]
+[spa]
+enabled = true
+fallback = "app.html"
+`)
+	t.Setenv("SPRAY_HEADERS_FILE", serverFile)
+
+	t.Run("site settings override server settings", func(t *testing.T) {
+		headers, _, err := loadHeaders(context.Background(), &mockHeaderStore{content: `
+[powered_by]
+enabled = false
+[spa]
+fallback = "shell.html"
+[cache.rollout]
+path_prefixes = ["/assets/"]
+`})
+		assert.NoError(t, err)
+		assert.False(t, headers.PoweredBy.Enabled, "set by the site")
+		assert.True(t, headers.Cache.Enabled, "set by the server")
+		assert.Equal(t, 86400, headers.Cache.Policies.MediumMaxAge, "default")
+		assert.True(t, headers.SPA.Enabled, "set by the server")
+		assert.Equal(t, "shell.html", headers.SPA.Fallback, "the site wins")
+		assert.Equal(t, []string{"/assets/"}, headers.Cache.RolloutConfig.PathPrefixes, "arrays are replaced, not appended")
+	})
+
+	t.Run("server settings apply without a site file", func(t *testing.T) {
+		headers, _, err := loadHeaders(context.Background(), &mockObjectStore{objects: map[string]mockObject{}})
+		assert.NoError(t, err)
+		assert.True(t, headers.Cache.Enabled)
+		assert.Equal(t, "app.html", headers.SPA.Fallback)
+		assert.True(t, headers.PoweredBy.Enabled)
+	})
+
+	t.Run("unknown keys are reported per layer", func(t *testing.T) {
+		writeTestFile(t, dir, "headers.toml", "[spa]\nenabeld = true\n")
+		_, warnings, err := loadHeaders(context.Background(), &mockHeaderStore{content: "[spa]\nfalback = \"x\"\n"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			`unknown key "spa.enabeld" in ` + serverFile + ` is ignored`,
+			`unknown key "spa.falback" in .spray/headers.toml is ignored`,
+		}, warnings)
+	})
+
+	t.Run("broken server files fail the load", func(t *testing.T) {
+		writeTestFile(t, dir, "headers.toml", "[clean_urls]\ntrailing_slash = \"sometimes\"\n")
+		_, _, err := loadHeaders(context.Background(), &mockHeaderStore{})
+		assert.Error(t, err)
+
+		writeTestFile(t, dir, "headers.toml", "not toml [")
+		_, _, err = loadHeaders(context.Background(), &mockHeaderStore{})
+		assert.Error(t, err)
+
+		t.Setenv("SPRAY_HEADERS_FILE", filepath.Join(dir, "missing.toml"))
+		_, _, err = loadHeaders(context.Background(), &mockHeaderStore{})
+		assert.Error(t, err)
+	})
+}
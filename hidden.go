@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Reasons a path is hidden, used as metric labels
+const (
+	hiddenReasonConfig  = "config"  // the .spray configuration directory
+	hiddenReasonDotfile = "dotfile" // a path segment starting with a dot
+	hiddenReasonPattern = "pattern" // a configured hidden pattern
+)
+
+// wellKnownDir stays servable when dotfiles are hidden; ACME challenges and
+// security.txt live there
+const wellKnownDir = ".well-known"
+
+// errHiddenPath is logged for requests refused because their path is hidden
+var errHiddenPath = errors.New("path is not servable")
+
+// HiddenConfig controls which objects are never served in addition to the .spray directory
+type HiddenConfig struct {
+	Dotfiles bool     `toml:"dotfiles" json:"dotfiles"` // hide paths with a segment starting with "." other than .well-known
+	Patterns []string `toml:"patterns" json:"patterns"` // e.g. "*.map", "/drafts/" or "/internal/*.json"
+}
+
+// validateHiddenPatterns checks that every hidden pattern is a valid glob
+func validateHiddenPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if strings.Trim(pattern, "/") == "" {
+			return fmt.Errorf("invalid hidden pattern %q: pattern is empty", pattern)
+		}
+		if _, err := path.Match(strings.Trim(pattern, "/"), ""); err != nil {
+			return fmt.Errorf("invalid hidden pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// hiddenPatternMatches reports whether an object key matches a hidden pattern.
+// Patterns ending in "/" hide a directory, patterns containing "/" match the whole
+// key and other patterns match any single segment, so "*.map" hides source maps anywhere.
+func hiddenPatternMatches(pattern, key string, segments []string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	if dir, ok := strings.CutSuffix(pattern, "/"); ok {
+		depth := strings.Count(dir, "/") + 1
+		if len(segments) < depth {
+			return false
+		}
+		matched, _ := path.Match(dir, strings.Join(segments[:depth], "/"))
+		return matched
+	}
+
+	if strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, key)
+		return matched
+	}
+
+	for _, segment := range segments {
+		if matched, _ := path.Match(pattern, segment); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenReason returns why an object key must not be served, or "" when it may be.
+// The .spray directory is always hidden, at any depth so prefixed virtual hosts are covered.
+func (s *gcsServer) hiddenReason(key string) string {
+	key = strings.Trim(key, "/")
+	segments := strings.Split(key, "/")
+	for _, segment := range segments {
+		if segment == configDir {
+			return hiddenReasonConfig
+		}
+	}
+
+	if s.headers == nil {
+		return ""
+	}
+	config := &s.headers.Hidden
+
+	if config.Dotfiles {
+		for _, segment := range segments {
+			if strings.HasPrefix(segment, ".") && segment != wellKnownDir {
+				return hiddenReasonDotfile
+			}
+		}
+	}
+	for _, pattern := range config.Patterns {
+		if hiddenPatternMatches(pattern, key, segments) {
+			return hiddenReasonPattern
+		}
+	}
+	return ""
+}
+
+// blockHiddenPath answers requests for hidden objects with 404 Not Found, exactly like
+// a missing object. It returns false when the path may be served.
+func (s *gcsServer) blockHiddenPath(w http.ResponseWriter, r *http.Request, cleanPath string) bool {
+	reason := s.hiddenReason(cleanPath)
+	if reason == "" {
+		return false
+	}
+
+	hiddenPathRequests.WithLabelValues(s.bucketName, reason).Inc()
+	s.sendUserFriendlyError(
+		w, r, cleanPath, http.StatusNotFound,
+		"The requested resource was not found.",
+		fmt.Errorf("%w: hidden by %s rule", errHiddenPath, reason),
+	)
+	return true
+}
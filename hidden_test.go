@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHiddenReason(t *testing.T) {
+	server := &gcsServer{headers: &HeaderConfig{Hidden: HiddenConfig{
+		Dotfiles: true,
+		Patterns: []string{"*.map", "/drafts/", "internal/*.json"},
+	}}}
+
+	cases := map[string]string{
+		".spray/redirects.toml":        hiddenReasonConfig,
+		"blog/.spray/headers.toml":     hiddenReasonConfig,
+		".env":                         hiddenReasonDotfile,
+		"app/.git/config":              hiddenReasonDotfile,
+		".well-known/security.txt":     "",
+		"js/app.js.map":                hiddenReasonPattern,
+		"drafts/index.html":            hiddenReasonPattern,
+		"drafts/2024/post.html":        hiddenReasonPattern,
+		"internal/keys.json":           hiddenReasonPattern,
+		"internal/nested/keys.json":    "",
+		"js/app.js":                    "",
+		"drafts-archive/index.html":    "",
+		"docs/spray/configuration.txt": "",
+	}
+	for key, want := range cases {
+		assert.Equal(t, want, server.hiddenReason(key), key)
+	}
+
+	// Without configuration only .spray is hidden
+	bare := &gcsServer{}
+	assert.Equal(t, hiddenReasonConfig, bare.hiddenReason(".spray/headers.toml"))
+	assert.Equal(t, "", bare.hiddenReason(".env"))
+}
+
+func TestValidateHiddenPatterns(t *testing.T) {
+	assert.NoError(t, validateHiddenPatterns([]string{"*.map", "/drafts/", "a/[bc]/*"}))
+	assert.Error(t, validateHiddenPatterns([]string{"[unclosed"}))
+	assert.Error(t, validateHiddenPatterns([]string{"/"}))
+}
+
+func TestServeHTTP_HiddenPaths(t *testing.T) {
+	const bucket = "hidden-bucket"
+	objects := map[string]mockObject{
+		".spray/redirects.toml":    {data: []byte("[redirects]"), contentType: "application/toml"},
+		".spray/headers.toml":      {data: []byte("[powered_by]"), contentType: "application/toml"},
+		".env":                     {data: []byte("SECRET=1"), contentType: "text/plain"},
+		".well-known/security.txt": {data: []byte("Contact: x"), contentType: "text/plain"},
+		"app.js":                   {data: []byte("js"), contentType: "application/javascript"},
+		"app.js.map":               {data: []byte("{}"), contentType: "application/json"},
+		"404.html":                 {data: []byte("custom 404"), contentType: "text/html"},
+		".spray/404.html":          {data: []byte("config 404"), contentType: "text/html"},
+		"drafts/404.html":          {data: []byte("drafts 404"), contentType: "text/html"},
+	}
+	headers := getDefaultHeaderConfig()
+	headers.Hidden = HiddenConfig{Dotfiles: true, Patterns: []string{"*.map", "/drafts/"}}
+	server := &gcsServer{
+		store:      &mockObjectStore{objects: objects},
+		bucketName: bucket,
+		logger:     &mockLogger{},
+		headers:    headers,
+		redirects:  map[string]RedirectRule{".spray/headers.toml": {To: "/app.js"}},
+	}
+	rewrites, err := compileRewrites(map[string]string{"/source": "/app.js.map"})
+	require.NoError(t, err)
+	server.rewrites = rewrites
+
+	serve := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("configuration is never served", func(t *testing.T) {
+		before := testutil.ToFloat64(hiddenPathRequests.WithLabelValues(bucket, hiddenReasonConfig))
+		for _, path := range []string{"/.spray/redirects.toml", "/.spray/headers.toml", "/%2Espray/redirects.toml", "//.spray//redirects.toml"} {
+			rr := serve(path, "application/json")
+			assert.Equal(t, http.StatusNotFound, rr.Code, path)
+			assert.NotContains(t, rr.Body.String(), "[redirects]", path)
+		}
+		assert.Equal(t, before+4, testutil.ToFloat64(hiddenPathRequests.WithLabelValues(bucket, hiddenReasonConfig)))
+	})
+
+	t.Run("dotfiles and patterns", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve("/.env", "application/json").Code)
+		assert.Equal(t, http.StatusNotFound, serve("/app.js.map", "application/json").Code)
+		assert.Equal(t, "Contact: x", serve("/.well-known/security.txt", "").Body.String())
+		assert.Equal(t, "js", serve("/app.js", "").Body.String())
+	})
+
+	t.Run("rewrites cannot expose hidden objects", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve("/source", "application/json").Code)
+	})
+
+	t.Run("browsers get the site's 404 page", func(t *testing.T) {
+		rr := serve("/.spray/redirects.toml", "text/html")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.Equal(t, "custom 404", rr.Body.String())
+	})
+
+	t.Run("hidden error pages are skipped", func(t *testing.T) {
+		for _, path := range []string{"/.spray/redirects.toml", "/drafts/post.html"} {
+			rr := serve(path, "text/html")
+			assert.Equal(t, http.StatusNotFound, rr.Code, path)
+			assert.Equal(t, "custom 404", rr.Body.String(), path)
+		}
+	})
+}
+
+func TestServeHTTP_HiddenResolvedObjects(t *testing.T) {
+	objects := map[string]mockObject{
+		"drafts/x.html":      {data: []byte("draft"), contentType: "text/html"},
+		"private/shell.html": {data: []byte("private shell"), contentType: "text/html"},
+		"app.js":             {data: []byte("js"), contentType: "application/javascript"},
+		"app.js.br":          {data: []byte("brotli"), contentType: "application/javascript"},
+	}
+	newServer := func(configure func(*HeaderConfig)) *gcsServer {
+		headers := getDefaultHeaderConfig()
+		configure(headers)
+		return &gcsServer{store: &mockObjectStore{objects: objects}, bucketName: "hidden-resolved-bucket", logger: &mockLogger{}, headers: headers}
+	}
+	serve := func(server *gcsServer, path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("clean URLs", func(t *testing.T) {
+		server := newServer(func(h *HeaderConfig) {
+			h.CleanURLs.Enabled = true
+			h.Hidden.Patterns = []string{"/drafts/*.html"}
+		})
+		for _, path := range []string{"/drafts/x.html", "/drafts/x", "/drafts/x/"} {
+			rr := serve(server, path, nil)
+			assert.Equal(t, http.StatusNotFound, rr.Code, path)
+			assert.NotContains(t, rr.Body.String(), "draft", path)
+		}
+	})
+
+	t.Run("SPA fallback", func(t *testing.T) {
+		server := newServer(func(h *HeaderConfig) {
+			h.SPA = SPAConfig{Enabled: true, Fallback: "/private/shell.html"}
+			h.Hidden.Patterns = []string{"/private/"}
+		})
+		rr := serve(server, "/dashboard", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "private shell")
+	})
+
+	t.Run("precompressed variants", func(t *testing.T) {
+		server := newServer(func(h *HeaderConfig) {
+			h.Precompressed.Enabled = true
+			h.Hidden.Patterns = []string{"*.br"}
+		})
+		rr := serve(server, "/app.js", http.Header{"Accept-Encoding": {"br"}})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "brotli")
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	})
+}
+
+func TestLoadHeaders_InvalidHiddenPattern(t *testing.T) {
+	_, _, err := loadHeaders(t.Context(), &mockHeaderStore{content: "[hidden]\npatterns = [\"[oops\"]\n"})
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "hidden pattern"))
+}
@@ -17,6 +17,16 @@ type StorageClient interface {
 // ObjectStore defines the interface for storage operations
 type ObjectStore interface {
 	GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error)
+	// GetObjectRange reads length bytes starting at offset; a negative length reads to the end.
+	// The returned attributes describe the whole object, so Size is the full object size.
+	GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error)
+	// GetObjectAttrs returns object metadata without opening the object body
+	GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error)
+	// ListObjects lists the objects and subdirectories directly below prefix, which is empty
+	// or ends in "/", in key order. Subdirectories are returned with only Prefix set, like
+	// GCS delimiter listings. At most limit entries are returned starting after pageToken;
+	// the returned token continues the listing and is empty on the last page.
+	ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error)
 }
 
 // Logger interface defines the logging operations we need
@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/spf13/cobra"
@@ -41,6 +43,24 @@ type debugMockObjectStore struct {
 	bucketName string
 }
 
+// newDebugMockObjectStore creates a debug store pre-populated with sample objects
+func newDebugMockObjectStore(bucketName string) *debugMockObjectStore {
+	mockStore := &debugMockObjectStore{
+		objects:    make(map[string]debugMockObject),
+		bucketName: bucketName,
+	}
+	// Add some sample objects for testing
+	mockStore.objects["index.html"] = debugMockObject{
+		data:        []byte("<html><body><h1>Mock Index Page</h1></body></html>"),
+		contentType: "text/html",
+	}
+	mockStore.objects["test.txt"] = debugMockObject{
+		data:        []byte("This is a test file"),
+		contentType: "text/plain",
+	}
+	return mockStore
+}
+
 func (s *debugMockObjectStore) GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error) {
 	if obj, ok := s.objects[path]; ok {
 		return io.NopCloser(strings.NewReader(string(obj.data))), &storage.ObjectAttrs{
@@ -51,6 +71,40 @@ func (s *debugMockObjectStore) GetObject(ctx context.Context, path string) (io.R
 	return nil, nil, storage.ErrObjectNotExist
 }
 
+func (s *debugMockObjectStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	reader, attrs, err := s.GetObject(ctx, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	limited, err := limitObjectReader(reader, offset, length)
+	if err != nil {
+		return nil, nil, err
+	}
+	return limited, attrs, nil
+}
+
+func (s *debugMockObjectStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	reader, attrs, err := s.GetObject(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	reader.Close()
+	return attrs, nil
+}
+
+func (s *debugMockObjectStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	entries := listKeys(keys, prefix, func(key string) *storage.ObjectAttrs {
+		obj := s.objects[key]
+		return &storage.ObjectAttrs{Name: key, ContentType: obj.contentType, Size: int64(len(obj.data))}
+	})
+	entries, next := paginateListing(entries, pageToken, limit)
+	return entries, next, nil
+}
+
 // storageClientFactory is a variable that can be replaced in tests
 var storageClientFactory = func(ctx context.Context) (StorageClient, error) {
 	// Check if we should use mock storage for debugging
@@ -140,12 +194,19 @@ func main() {
 	ctx := context.Background()
 
 	var port string
+	var source string
+	var hostsFile string
+	var objectCache ObjectCacheConfig
+	var objectCacheTTL time.Duration
+	var reloadInterval time.Duration
+	var configEndpoints string
 
 	rootCmd := &cobra.Command{
 		Use:   "spray",
 		Short: "Spray is a GCS static file server.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return startServer(ctx, port)
+			objectCache.TTLSeconds = int(objectCacheTTL / time.Second)
+			return startServer(ctx, &config{port: port, source: source, hostsFile: hostsFile, objectCache: objectCache, reloadInterval: reloadInterval, configEndpoints: configEndpoints})
 		},
 	}
 
@@ -159,15 +220,29 @@ func main() {
 	}
 
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(newValidateCommand())
 	rootCmd.Flags().StringVar(&port, "port", "8080", "Server port")
+	rootCmd.Flags().StringVar(&source, "source", "", "Content source, e.g. gs://bucket or file:///srv/site (default: SPRAY_SOURCE or gs://$BUCKET_NAME)")
+	rootCmd.Flags().StringVar(&hostsFile, "hosts", "", "Virtual hosts file mapping Host headers to buckets (default: SPRAY_HOSTS_FILE)")
+	rootCmd.Flags().BoolVar(&objectCache.Enabled, "object-cache", false, "Cache small objects in memory in front of the content source")
+	rootCmd.Flags().BoolVar(&objectCache.AllowSites, "object-cache-allow-sites", false, "Let sites enable the object cache from headers.toml")
+	rootCmd.Flags().Int64Var(&objectCache.MaxBytes, "object-cache-max-bytes", defaultObjectCacheMaxBytes, "Memory budget of the object cache in bytes")
+	rootCmd.Flags().Int64Var(&objectCache.MaxObjectSize, "object-cache-max-object-size", defaultObjectCacheMaxObjectSize, "Largest object in bytes kept in the object cache")
+	rootCmd.Flags().DurationVar(&objectCacheTTL, "object-cache-ttl", defaultObjectCacheTTLSeconds*time.Second, "Time before a cached object is revalidated against the content source")
+	rootCmd.Flags().DurationVar(&reloadInterval, "config-reload-interval", 0, "How often .spray configuration is checked for changes and reloaded; 0 disables polling (default: SPRAY_CONFIG_RELOAD_INTERVAL)")
+	rootCmd.Flags().StringVar(&configEndpoints, "config-endpoints", "", "Access to the /config endpoints: public, protected (requires the admin token) or disabled (default: SPRAY_CONFIG_ENDPOINTS or public)")
 
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		log.Fatal(err)
 	}
 }
 
 // startServer handles the server initialization and startup
-func startServer(ctx context.Context, port string) error {
+func startServer(ctx context.Context, base *config) error {
 	// Initialize logging
 	logClient, err := loggingClientFactory(ctx, os.Getenv("GOOGLE_PROJECT_ID"))
 	if err != nil {
@@ -176,44 +251,30 @@ func startServer(ctx context.Context, port string) error {
 	defer logClient.Close()
 
 	// Log startup message
-	log.Printf("Spray version %s starting up on port %s", Version, port)
+	log.Printf("Spray version %s starting up on port %s", Version, base.port)
 
 	// Load initial config without store to get bucket name
-	cfg, err := loadConfig(ctx, &config{port: port}, nil)
+	cfg, err := loadConfig(ctx, base, nil)
 	if err != nil {
 		return fmt.Errorf("failed to load config: %v", err)
 	}
 
-	// Create storage client
-	storageClient, err := storageClientFactory(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to create storage client: %v", err)
+	// Serve every site in the hosts file from this process
+	if cfg.hostsFile != "" {
+		srv, closeStores, err := createVirtualHostServer(ctx, cfg, logClient)
+		if err != nil {
+			return fmt.Errorf("failed to create virtual host server: %v", err)
+		}
+		defer closeStores()
+		return runServerImpl(ctx, srv)
 	}
-	defer storageClient.Close()
 
-	// Create store
-	var store ObjectStore
-	if os.Getenv("STORAGE_MOCK") == "true" {
-		// Use mock store for debugging
-		mockStore := &debugMockObjectStore{
-			objects:    make(map[string]debugMockObject),
-			bucketName: cfg.bucketName,
-		}
-		// Add some sample objects for testing
-		mockStore.objects["index.html"] = debugMockObject{
-			data:        []byte("<html><body><h1>Mock Index Page</h1></body></html>"),
-			contentType: "text/html",
-		}
-		mockStore.objects["test.txt"] = debugMockObject{
-			data:        []byte("This is a test file"),
-			contentType: "text/plain",
-		}
-		store = mockStore
-	} else {
-		store = &GCSObjectStore{
-			bucket: storageClient.Bucket(cfg.bucketName),
-		}
+	// Create store for the configured source
+	store, closeStore, err := createObjectStore(ctx, cfg)
+	if err != nil {
+		return err
 	}
+	defer closeStore()
 
 	// Reload config with store to get redirects
 	cfg, err = loadConfig(ctx, cfg, store)
@@ -247,17 +308,22 @@ func RunApp(ctx context.Context, port string) error {
 	// Log startup message
 	log.Printf("Spray version %s starting up on port %s", Version, port)
 
-	// Create storage client
-	storageClient, err := storageClientFactory(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to create storage client: %v", err)
+	// Serve every site in the hosts file from this process
+	if cfg.hostsFile != "" {
+		srv, closeStores, err := createVirtualHostServer(ctx, cfg, logClient)
+		if err != nil {
+			return err
+		}
+		defer closeStores()
+		return runServerImpl(ctx, srv)
 	}
-	defer storageClient.Close()
 
-	// Create store
-	store := &GCSObjectStore{
-		bucket: storageClient.Bucket(cfg.bucketName),
+	// Create store for the configured source
+	store, closeStore, err := createObjectStore(ctx, cfg)
+	if err != nil {
+		return err
 	}
+	defer closeStore()
 
 	// Reload config with store to get redirects
 	cfg, err = loadConfig(ctx, cfg, store)
@@ -34,6 +34,15 @@ var (
 		[]string{"bucket_name", "path", "method", "direction"}, // direction can be "upload" or "download"
 	)
 
+	// compressionBytesSaved tracks bytes saved by on-the-fly gzip compression
+	compressionBytesSaved = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_compression_bytes_saved_total",
+			Help: "Total number of bytes saved by compressing responses on the fly",
+		},
+		[]string{"bucket_name", "content_type"},
+	)
+
 	// activeRequests tracks the number of currently active requests
 	activeRequests = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -108,13 +117,156 @@ var (
 		[]string{"bucket_name", "operation"}, // operation: get_object, get_attrs
 	)
 
+	// rangeRequests tracks how Range requests were handled
+	rangeRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_range_requests_total",
+			Help: "Total number of Range requests by outcome",
+		},
+		[]string{"bucket_name", "result"}, // result: single/multi/unsatisfiable/ignored/if_range_mismatch
+	)
+
+	// objectCacheRequests tracks in-memory object cache lookups
+	objectCacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_object_cache_requests_total",
+			Help: "Total number of in-memory object cache lookups by result",
+		},
+		[]string{"bucket_name", "result"}, // result: hit/miss/revalidated
+	)
+
+	// objectCacheEvictions tracks entries removed from the in-memory object cache
+	objectCacheEvictions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_object_cache_evictions_total",
+			Help: "Total number of in-memory object cache evictions",
+		},
+		[]string{"bucket_name", "reason"}, // reason: capacity/stale
+	)
+
+	// objectCacheBytes tracks the memory held by the in-memory object cache
+	objectCacheBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gcs_server_object_cache_bytes",
+			Help: "Number of bytes held by the in-memory object cache",
+		},
+		[]string{"bucket_name"},
+	)
+
+	// coalescedRequests tracks storage fetches shared with a concurrent request for the same path
+	coalescedRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_coalesced_requests_total",
+			Help: "Total number of storage fetches served by a concurrent fetch of the same object",
+		},
+		[]string{"bucket_name", "operation"}, // operation: get_object, get_attrs
+	)
+
+	// precompressedResponses tracks which encoding was served for negotiable objects
+	precompressedResponses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_precompressed_responses_total",
+			Help: "Total number of responses for objects with precompressed variants enabled, by encoding served",
+		},
+		[]string{"bucket_name", "encoding"}, // encoding: br/gzip/identity
+	)
+
+	// unknownHostRequests tracks requests for hosts missing from the virtual hosts file
+	unknownHostRequests = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gcs_server_unknown_host_requests_total",
+			Help: "Total number of requests for hosts not configured in the virtual hosts file",
+		},
+	)
+
 	// redirectHits tracks the number of redirects served
 	redirectHits = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "gcs_server_redirects_total",
 			Help: "Total number of redirects served",
 		},
-		[]string{"bucket_name", "path", "destination"},
+		[]string{"bucket_name", "path", "destination", "status"},
+	)
+
+	// rewritesTotal tracks the number of requests served through internal rewrites
+	rewritesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_rewrites_total",
+			Help: "Total number of requests served through internal rewrites",
+		},
+		[]string{"bucket_name", "rule"},
+	)
+
+	// spaFallbacks tracks requests answered with the SPA fallback object
+	spaFallbacks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_spa_fallback_total",
+			Help: "Total number of requests for missing paths served with the SPA fallback object",
+		},
+		[]string{"bucket_name"},
+	)
+
+	// customErrorPages tracks error responses served with an error page from the bucket
+	customErrorPages = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_custom_error_pages_total",
+			Help: "Total number of error responses served with a custom error page from the bucket",
+		},
+		[]string{"bucket_name", "status"},
+	)
+
+	// cleanURLRequests tracks how clean URLs were resolved
+	cleanURLRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_clean_url_requests_total",
+			Help: "Total number of clean URL requests resolved to path.html or path/index.html, or redirected to their canonical form",
+		},
+		[]string{"bucket_name", "result"}, // result: html, index, redirect
+	)
+
+	// autoindexRequests tracks generated directory listings by response format
+	autoindexRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_autoindex_requests_total",
+			Help: "Total number of generated directory listings served",
+		},
+		[]string{"bucket_name", "format"}, // format: html, json
+	)
+
+	// hiddenPathRequests tracks requests refused because their path is hidden
+	hiddenPathRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_hidden_path_requests_total",
+			Help: "Total number of requests for .spray configuration or hidden paths answered with 404",
+		},
+		[]string{"bucket_name", "reason"}, // reason: config, dotfile, pattern
+	)
+
+	// configReloads tracks attempts to reload the .spray configuration
+	configReloads = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_config_reloads_total",
+			Help: "Total number of .spray configuration reloads by result",
+		},
+		[]string{"bucket_name", "result"}, // result: success, failure
+	)
+
+	// configLastReload records when the configuration in effect was loaded
+	configLastReload = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gcs_server_config_last_reload_timestamp_seconds",
+			Help: "Unix time at which the .spray configuration in effect was loaded",
+		},
+		[]string{"bucket_name"},
+	)
+
+	// configUnknownKeys counts keys in configuration files that no setting uses
+	configUnknownKeys = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gcs_server_config_unknown_keys_total",
+			Help: "Keys found in .spray configuration files that no setting uses",
+		},
+		[]string{"file"},
 	)
 
 	// redirectLatency tracks the time taken to process redirects
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+const (
+	defaultObjectCacheMaxBytes      = 64 << 20 // 64 MiB
+	defaultObjectCacheMaxObjectSize = 1 << 20  // 1 MiB
+	defaultObjectCacheTTLSeconds    = 60
+)
+
+// ObjectCacheConfig controls the in-memory object cache in front of the store
+type ObjectCacheConfig struct {
+	Enabled       bool  `toml:"enabled" json:"enabled"`
+	MaxBytes      int64 `toml:"max_bytes" json:"max_bytes"`             // total byte budget, default: 64 MiB
+	MaxObjectSize int64 `toml:"max_object_size" json:"max_object_size"` // larger objects are never cached, default: 1 MiB
+	TTLSeconds    int   `toml:"ttl_seconds" json:"ttl_seconds"`         // seconds before an entry is revalidated, default: 60
+	AllowSites    bool  `toml:"-" json:"-"`                             // server only: sites may enable the cache from headers.toml
+}
+
+// resolveObjectCacheConfig merges the server-level cache settings (from flags) with the
+// site's headers.toml. Sites can only enable the cache when the server allows them to.
+// They can shorten the TTL and shrink the memory limits, but never raise them above the
+// server values, so that in vhost mode no tenant decides how much memory the server uses.
+func resolveObjectCacheConfig(server ObjectCacheConfig, headers *HeaderConfig) ObjectCacheConfig {
+	resolved := ObjectCacheConfig{
+		Enabled:       server.Enabled,
+		MaxBytes:      defaultObjectCacheMaxBytes,
+		MaxObjectSize: defaultObjectCacheMaxObjectSize,
+		TTLSeconds:    defaultObjectCacheTTLSeconds,
+	}
+	if server.MaxBytes > 0 {
+		resolved.MaxBytes = server.MaxBytes
+	}
+	if server.MaxObjectSize > 0 {
+		resolved.MaxObjectSize = server.MaxObjectSize
+	}
+	if server.TTLSeconds > 0 {
+		resolved.TTLSeconds = server.TTLSeconds
+	}
+	if headers == nil {
+		return resolved
+	}
+
+	site := headers.ObjectCache
+	resolved.Enabled = resolved.Enabled || (server.AllowSites && site.Enabled)
+	if site.MaxBytes > 0 {
+		resolved.MaxBytes = min(resolved.MaxBytes, site.MaxBytes)
+	}
+	if site.MaxObjectSize > 0 {
+		resolved.MaxObjectSize = min(resolved.MaxObjectSize, site.MaxObjectSize)
+	}
+	if site.TTLSeconds > 0 {
+		resolved.TTLSeconds = site.TTLSeconds
+	}
+	return resolved
+}
+
+// servingStore returns the store used to serve requests: concurrent fetches are
+// coalesced, and an object cache sits in front when one is enabled. Configuration
+// files are always read from cfg.store directly.
+func servingStore(cfg *config) ObjectStore {
+	if cfg.store == nil {
+		return nil
+	}
+	var store ObjectStore = newCoalescingObjectStore(cfg.bucketName, cfg.store)
+	cacheConfig := resolveObjectCacheConfig(cfg.objectCache, cfg.headers)
+	if !cacheConfig.Enabled {
+		return store
+	}
+	return newCachingObjectStore(cfg.bucketName, store, cacheConfig)
+}
+
+// objectCacheEntry holds cached metadata and, once read, the object body
+type objectCacheEntry struct {
+	path      string
+	attrs     *storage.ObjectAttrs
+	data      []byte
+	hasData   bool
+	checkedAt time.Time
+}
+
+// cost is the number of bytes an entry counts against the cache budget
+func (e *objectCacheEntry) cost() int64 {
+	return int64(len(e.path) + len(e.data))
+}
+
+// cachingObjectStore is an ObjectStore decorator that keeps small objects in memory.
+// Entries are evicted in least-recently-used order once the byte budget is exceeded.
+// After the TTL passes, entries are revalidated against the backing store's metadata
+// and kept only if the object's generation (or ETag) is unchanged.
+type cachingObjectStore struct {
+	store      ObjectStore
+	bucketName string
+	config     ObjectCacheConfig
+	now        func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List // front is most recently used
+	entries map[string]*list.Element
+	size    int64
+}
+
+// newCachingObjectStore wraps store with an in-memory LRU cache
+func newCachingObjectStore(bucketName string, store ObjectStore, cfg ObjectCacheConfig) *cachingObjectStore {
+	return &cachingObjectStore{
+		store:      store,
+		bucketName: bucketName,
+		config:     cfg,
+		now:        time.Now,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// GetObject returns the object from memory when cached, otherwise reads it from the store
+func (c *cachingObjectStore) GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return c.getObject(ctx, path, func() (io.ReadCloser, *storage.ObjectAttrs, error) {
+		return c.store.GetObject(ctx, path)
+	})
+}
+
+// getObject returns the object from memory when cached, otherwise calls read and caches
+// the body it returns when small enough
+func (c *cachingObjectStore) getObject(ctx context.Context, path string, read func() (io.ReadCloser, *storage.ObjectAttrs, error)) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	if entry, ok := c.lookup(ctx, path, true); ok {
+		return io.NopCloser(bytes.NewReader(entry.data)), copyObjectAttrs(entry.attrs), nil
+	}
+
+	reader, attrs, err := read()
+	if err != nil {
+		return nil, nil, err
+	}
+	if attrs.Size > c.config.MaxObjectSize {
+		return reader, attrs, nil
+	}
+
+	// Read one byte past the limit so objects with an unreliable size are not cached
+	data, err := io.ReadAll(io.LimitReader(reader, c.config.MaxObjectSize+1))
+	if err != nil {
+		reader.Close()
+		return nil, nil, err
+	}
+	if int64(len(data)) > c.config.MaxObjectSize {
+		return &rangeReadCloser{Reader: io.MultiReader(bytes.NewReader(data), reader), Closer: reader}, attrs, nil
+	}
+	reader.Close()
+
+	c.put(path, attrs, data, true)
+	return io.NopCloser(bytes.NewReader(data)), copyObjectAttrs(attrs), nil
+}
+
+// GetObjectRange serves ranges of cached objects from memory. Reads of a whole
+// object populate the cache from a ranged read, which returns the metadata without a
+// second lookup; other ranges of uncached objects go to the store.
+func (c *cachingObjectStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	if offset == 0 && length < 0 {
+		return c.getObject(ctx, path, func() (io.ReadCloser, *storage.ObjectAttrs, error) {
+			return c.store.GetObjectRange(ctx, path, 0, -1)
+		})
+	}
+
+	if entry, ok := c.lookup(ctx, path, true); ok {
+		data := entry.data
+		if offset > int64(len(data)) {
+			offset = int64(len(data))
+		}
+		data = data[offset:]
+		if length >= 0 && length < int64(len(data)) {
+			data = data[:length]
+		}
+		return io.NopCloser(bytes.NewReader(data)), copyObjectAttrs(entry.attrs), nil
+	}
+	return c.store.GetObjectRange(ctx, path, offset, length)
+}
+
+// GetObjectAttrs returns cached metadata, remembering it for later requests
+func (c *cachingObjectStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	if entry, ok := c.lookup(ctx, path, false); ok {
+		return copyObjectAttrs(entry.attrs), nil
+	}
+
+	attrs, err := c.store.GetObjectAttrs(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if attrs.Size <= c.config.MaxObjectSize {
+		c.put(path, attrs, nil, false)
+	}
+	return attrs, nil
+}
+
+// ListObjects is not cached; listings go straight to the store
+func (c *cachingObjectStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	return c.store.ListObjects(ctx, prefix, pageToken, limit)
+}
+
+// lookup returns a usable cache entry for path, revalidating it when its TTL has
+// passed. When needData is set, entries holding only metadata count as misses.
+func (c *cachingObjectStore) lookup(ctx context.Context, path string, needData bool) (objectCacheEntry, bool) {
+	c.mu.Lock()
+	elem, ok := c.entries[path]
+	if !ok {
+		c.mu.Unlock()
+		objectCacheRequests.WithLabelValues(c.bucketName, "miss").Inc()
+		return objectCacheEntry{}, false
+	}
+	entry := *elem.Value.(*objectCacheEntry)
+	fresh := c.now().Sub(entry.checkedAt) < time.Duration(c.config.TTLSeconds)*time.Second
+	if fresh && (entry.hasData || !needData) {
+		c.lru.MoveToFront(elem)
+		c.mu.Unlock()
+		objectCacheRequests.WithLabelValues(c.bucketName, "hit").Inc()
+		return entry, true
+	}
+	c.mu.Unlock()
+
+	if fresh {
+		// Metadata is cached but the body has not been read yet
+		objectCacheRequests.WithLabelValues(c.bucketName, "miss").Inc()
+		return objectCacheEntry{}, false
+	}
+
+	// The entry is stale: keep it only if the object has not changed
+	gcsStart := time.Now()
+	attrs, err := c.store.GetObjectAttrs(ctx, path)
+	gcsLatency.WithLabelValues(c.bucketName, "revalidate").Observe(time.Since(gcsStart).Seconds())
+	if err != nil || objectVersion(attrs) != objectVersion(entry.attrs) {
+		c.remove(path, "stale")
+		objectCacheRequests.WithLabelValues(c.bucketName, "miss").Inc()
+		if err == nil && !needData {
+			// The fresh metadata can be cached and returned straight away
+			if attrs.Size <= c.config.MaxObjectSize {
+				c.put(path, attrs, nil, false)
+			}
+			return objectCacheEntry{path: path, attrs: attrs}, true
+		}
+		return objectCacheEntry{}, false
+	}
+
+	c.mu.Lock()
+	if elem, ok := c.entries[path]; ok {
+		cached := elem.Value.(*objectCacheEntry)
+		cached.checkedAt = c.now()
+		cached.attrs = attrs
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+
+	if needData && !entry.hasData {
+		objectCacheRequests.WithLabelValues(c.bucketName, "miss").Inc()
+		return objectCacheEntry{}, false
+	}
+	objectCacheRequests.WithLabelValues(c.bucketName, "revalidated").Inc()
+	entry.attrs = attrs
+	return entry, true
+}
+
+// put stores an entry and evicts least recently used entries beyond the byte budget
+func (c *cachingObjectStore) put(path string, attrs *storage.ObjectAttrs, data []byte, hasData bool) {
+	entry := &objectCacheEntry{
+		path:      path,
+		attrs:     copyObjectAttrs(attrs),
+		data:      data,
+		hasData:   hasData,
+		checkedAt: c.now(),
+	}
+	if entry.cost() > c.config.MaxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[path]; ok {
+		c.size -= elem.Value.(*objectCacheEntry).cost()
+		c.lru.Remove(elem)
+	}
+	c.entries[path] = c.lru.PushFront(entry)
+	c.size += entry.cost()
+
+	for c.size > c.config.MaxBytes {
+		oldest := c.lru.Back()
+		evicted := oldest.Value.(*objectCacheEntry)
+		c.lru.Remove(oldest)
+		delete(c.entries, evicted.path)
+		c.size -= evicted.cost()
+		objectCacheEvictions.WithLabelValues(c.bucketName, "capacity").Inc()
+	}
+	objectCacheBytes.WithLabelValues(c.bucketName).Set(float64(c.size))
+}
+
+// remove drops an entry from the cache
+func (c *cachingObjectStore) remove(path, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[path]
+	if !ok {
+		return
+	}
+	c.size -= elem.Value.(*objectCacheEntry).cost()
+	c.lru.Remove(elem)
+	delete(c.entries, path)
+	objectCacheEvictions.WithLabelValues(c.bucketName, reason).Inc()
+	objectCacheBytes.WithLabelValues(c.bucketName).Set(float64(c.size))
+}
+
+// objectVersion identifies an object revision: the GCS generation when known,
+// then the ETag, falling back to modification time and size
+func objectVersion(attrs *storage.ObjectAttrs) string {
+	switch {
+	case attrs.Generation != 0:
+		return fmt.Sprintf("g%d.%d", attrs.Generation, attrs.Metageneration)
+	case attrs.Etag != "":
+		return "e" + attrs.Etag
+	default:
+		return fmt.Sprintf("t%d.%d", attrs.Updated.UnixNano(), attrs.Size)
+	}
+}
+
+// copyObjectAttrs returns a shallow copy so callers cannot modify cached metadata
+func copyObjectAttrs(attrs *storage.ObjectAttrs) *storage.ObjectAttrs {
+	copied := *attrs
+	return &copied
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// versionedObject is an object held by versionedObjectStore
+type versionedObject struct {
+	data       string
+	generation int64
+}
+
+// versionedObjectStore is a backing store that counts calls and reports generations
+type versionedObjectStore struct {
+	objects    map[string]versionedObject
+	bodyReads  int // GetObject calls, including those made for ranged reads
+	rangeReads int
+	attrsReads int
+}
+
+func (s *versionedObjectStore) attrs(path string) (*storage.ObjectAttrs, error) {
+	obj, ok := s.objects[path]
+	if !ok {
+		return nil, storage.ErrObjectNotExist
+	}
+	return &storage.ObjectAttrs{
+		Name:        path,
+		ContentType: "text/plain",
+		Size:        int64(len(obj.data)),
+		Generation:  obj.generation,
+	}, nil
+}
+
+func (s *versionedObjectStore) GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	s.bodyReads++
+	attrs, err := s.attrs(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &mockReader{data: []byte(s.objects[path].data)}, attrs, nil
+}
+
+func (s *versionedObjectStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	s.rangeReads++
+	return getObjectRangeFromFull(s, ctx, path, offset, length)
+}
+
+func (s *versionedObjectStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	s.attrsReads++
+	return s.attrs(path)
+}
+
+func (s *versionedObjectStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	return nil, "", nil
+}
+
+func readCachedObject(t *testing.T, store ObjectStore, path string) string {
+	t.Helper()
+	reader, _, err := store.GetObject(context.Background(), path)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestCachingObjectStore_HitsAndMisses(t *testing.T) {
+	backing := &versionedObjectStore{objects: map[string]versionedObject{
+		"index.html": {data: "<h1>home</h1>", generation: 1},
+	}}
+	cache := newCachingObjectStore("test-bucket", backing, ObjectCacheConfig{Enabled: true, MaxBytes: 1024, MaxObjectSize: 512, TTLSeconds: 60})
+
+	assert.Equal(t, "<h1>home</h1>", readCachedObject(t, cache, "index.html"))
+	assert.Equal(t, "<h1>home</h1>", readCachedObject(t, cache, "index.html"))
+	assert.Equal(t, 1, backing.bodyReads, "second read should be served from memory")
+
+	attrs, err := cache.GetObjectAttrs(context.Background(), "index.html")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), attrs.Generation)
+	assert.Zero(t, backing.attrsReads, "cached metadata should not hit the store")
+
+	reader, _, err := cache.GetObjectRange(context.Background(), "index.html", 4, 4)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(reader)
+	assert.Equal(t, "home", string(data))
+	assert.Equal(t, 1, backing.bodyReads)
+
+	_, _, err = cache.GetObject(context.Background(), "missing.html")
+	assert.Equal(t, storage.ErrObjectNotExist, err)
+}
+
+func TestCachingObjectStore_AttrsThenBody(t *testing.T) {
+	backing := &versionedObjectStore{objects: map[string]versionedObject{
+		"style.css": {data: "body{}", generation: 3},
+	}}
+	cache := newCachingObjectStore("test-bucket", backing, ObjectCacheConfig{Enabled: true, MaxBytes: 1024, MaxObjectSize: 512, TTLSeconds: 60})
+
+	// The serving path fetches metadata first and then the whole body
+	for i := 0; i < 3; i++ {
+		_, err := cache.GetObjectAttrs(context.Background(), "style.css")
+		require.NoError(t, err)
+		reader, _, err := cache.GetObjectRange(context.Background(), "style.css", 0, -1)
+		require.NoError(t, err)
+		data, _ := io.ReadAll(reader)
+		assert.Equal(t, "body{}", string(data))
+	}
+	assert.Equal(t, 1, backing.attrsReads)
+	assert.Equal(t, 1, backing.bodyReads)
+	assert.Equal(t, 1, backing.rangeReads, "a miss fills the cache from a ranged read, which needs no second metadata lookup")
+}
+
+func TestCachingObjectStore_Eviction(t *testing.T) {
+	backing := &versionedObjectStore{objects: map[string]versionedObject{
+		"a":   {data: "aaaaaaaaa", generation: 1},
+		"b":   {data: "bbbbbbbbb", generation: 1},
+		"c":   {data: "ccccccccc", generation: 1},
+		"big": {data: "this object is larger than the per-object limit", generation: 1},
+	}}
+	// Each entry costs 10 bytes, so only two fit
+	cache := newCachingObjectStore("test-bucket", backing, ObjectCacheConfig{Enabled: true, MaxBytes: 20, MaxObjectSize: 16, TTLSeconds: 60})
+
+	readCachedObject(t, cache, "a")
+	readCachedObject(t, cache, "b")
+	readCachedObject(t, cache, "a") // a is now more recently used than b
+	readCachedObject(t, cache, "c") // evicts b
+	assert.Equal(t, 3, backing.bodyReads)
+	assert.Equal(t, int64(20), cache.size)
+
+	readCachedObject(t, cache, "a")
+	assert.Equal(t, 3, backing.bodyReads, "a should have survived eviction")
+	readCachedObject(t, cache, "b")
+	assert.Equal(t, 4, backing.bodyReads, "b should have been evicted")
+
+	assert.Equal(t, "this object is larger than the per-object limit", readCachedObject(t, cache, "big"))
+	readCachedObject(t, cache, "big")
+	assert.Equal(t, 6, backing.bodyReads, "objects above the size limit are never cached")
+	assert.LessOrEqual(t, cache.size, int64(20))
+}
+
+func TestCachingObjectStore_Revalidation(t *testing.T) {
+	backing := &versionedObjectStore{objects: map[string]versionedObject{
+		"index.html": {data: "v1", generation: 1},
+	}}
+	cache := newCachingObjectStore("test-bucket", backing, ObjectCacheConfig{Enabled: true, MaxBytes: 1024, MaxObjectSize: 512, TTLSeconds: 60})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	assert.Equal(t, "v1", readCachedObject(t, cache, "index.html"))
+
+	// After the TTL an unchanged generation keeps the cached body
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, "v1", readCachedObject(t, cache, "index.html"))
+	assert.Equal(t, 1, backing.bodyReads)
+	assert.Equal(t, 1, backing.attrsReads)
+
+	// Within the refreshed TTL no revalidation happens
+	readCachedObject(t, cache, "index.html")
+	assert.Equal(t, 1, backing.attrsReads)
+
+	// A new generation replaces the cached body
+	backing.objects["index.html"] = versionedObject{data: "v2", generation: 2}
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, "v2", readCachedObject(t, cache, "index.html"))
+	assert.Equal(t, 2, backing.bodyReads)
+
+	// Deleted objects are dropped from the cache
+	delete(backing.objects, "index.html")
+	now = now.Add(2 * time.Minute)
+	_, err := cache.GetObjectAttrs(context.Background(), "index.html")
+	assert.Equal(t, storage.ErrObjectNotExist, err)
+	assert.Empty(t, cache.entries)
+}
+
+func TestObjectVersion(t *testing.T) {
+	updated := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "g5.2", objectVersion(&storage.ObjectAttrs{Generation: 5, Metageneration: 2, Etag: "x"}))
+	assert.Equal(t, "eabc", objectVersion(&storage.ObjectAttrs{Etag: "abc"}))
+	assert.NotEqual(t,
+		objectVersion(&storage.ObjectAttrs{Updated: updated, Size: 1}),
+		objectVersion(&storage.ObjectAttrs{Updated: updated.Add(time.Second), Size: 1}))
+}
+
+func TestResolveObjectCacheConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		resolved := resolveObjectCacheConfig(ObjectCacheConfig{}, nil)
+		assert.False(t, resolved.Enabled)
+		assert.Equal(t, int64(defaultObjectCacheMaxBytes), resolved.MaxBytes)
+		assert.Equal(t, int64(defaultObjectCacheMaxObjectSize), resolved.MaxObjectSize)
+		assert.Equal(t, defaultObjectCacheTTLSeconds, resolved.TTLSeconds)
+	})
+
+	t.Run("server flags", func(t *testing.T) {
+		resolved := resolveObjectCacheConfig(ObjectCacheConfig{Enabled: true, MaxBytes: 100, TTLSeconds: 5}, getDefaultHeaderConfig())
+		assert.Equal(t, ObjectCacheConfig{Enabled: true, MaxBytes: 100, MaxObjectSize: defaultObjectCacheMaxObjectSize, TTLSeconds: 5}, resolved)
+	})
+
+	t.Run("headers.toml can shrink the limits", func(t *testing.T) {
+		headers := getDefaultHeaderConfig()
+		headers.ObjectCache = ObjectCacheConfig{Enabled: true, MaxBytes: 40, MaxObjectSize: 20, TTLSeconds: 5}
+		resolved := resolveObjectCacheConfig(ObjectCacheConfig{AllowSites: true, MaxBytes: 100, MaxObjectSize: 50}, headers)
+		assert.Equal(t, ObjectCacheConfig{Enabled: true, MaxBytes: 40, MaxObjectSize: 20, TTLSeconds: 5}, resolved)
+	})
+
+	t.Run("headers.toml enables the cache only when the server allows it", func(t *testing.T) {
+		headers := getDefaultHeaderConfig()
+		headers.ObjectCache.Enabled = true
+		assert.False(t, resolveObjectCacheConfig(ObjectCacheConfig{}, headers).Enabled)
+		assert.True(t, resolveObjectCacheConfig(ObjectCacheConfig{AllowSites: true}, headers).Enabled)
+	})
+
+	t.Run("headers.toml cannot raise the limits", func(t *testing.T) {
+		headers := getDefaultHeaderConfig()
+		headers.ObjectCache = ObjectCacheConfig{Enabled: true, MaxBytes: 1 << 40, MaxObjectSize: 2048}
+		resolved := resolveObjectCacheConfig(ObjectCacheConfig{AllowSites: true, MaxBytes: 100, MaxObjectSize: 50}, headers)
+		assert.Equal(t, ObjectCacheConfig{Enabled: true, MaxBytes: 100, MaxObjectSize: 50, TTLSeconds: defaultObjectCacheTTLSeconds}, resolved)
+
+		resolved = resolveObjectCacheConfig(ObjectCacheConfig{AllowSites: true}, headers)
+		assert.Equal(t, int64(defaultObjectCacheMaxBytes), resolved.MaxBytes, "without flags the defaults are the limit")
+	})
+}
+
+func TestServingStore(t *testing.T) {
+	backing := &versionedObjectStore{}
+	coalescing, ok := servingStore(&config{store: backing, headers: getDefaultHeaderConfig()}).(*coalescingObjectStore)
+	require.True(t, ok, "fetches are always coalesced")
+	assert.Same(t, backing, coalescing.store)
+
+	cached, ok := servingStore(&config{store: backing, objectCache: ObjectCacheConfig{Enabled: true}}).(*cachingObjectStore)
+	require.True(t, ok)
+	coalescing, ok = cached.store.(*coalescingObjectStore)
+	require.True(t, ok, "cache misses are coalesced")
+	assert.Same(t, backing, coalescing.store)
+
+	headers := getDefaultHeaderConfig()
+	headers.ObjectCache.Enabled = true
+	_, ok = servingStore(&config{store: backing, headers: headers}).(*cachingObjectStore)
+	assert.False(t, ok, "headers.toml cannot enable the cache on its own")
+	_, ok = servingStore(&config{store: backing, objectCache: ObjectCacheConfig{AllowSites: true}, headers: headers}).(*cachingObjectStore)
+	assert.True(t, ok, "headers.toml can enable the cache when the server allows it")
+
+	assert.Nil(t, servingStore(&config{}))
+}
@@ -146,6 +146,42 @@ func (m *MockObjectStorage) GetObject(ctx context.Context, path string) (io.Read
 	return reader, attrs, args.Error(2)
 }
 
+// GetObjectRange implements the ObjectStore interface
+func (m *MockObjectStorage) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	args := m.Called(ctx, path, offset, length)
+	var reader io.ReadCloser
+	if args.Get(0) != nil {
+		reader = args.Get(0).(io.ReadCloser)
+	}
+
+	var attrs *storage.ObjectAttrs
+	if args.Get(1) != nil {
+		attrs = args.Get(1).(*storage.ObjectAttrs)
+	}
+
+	return reader, attrs, args.Error(2)
+}
+
+// GetObjectAttrs implements the ObjectStore interface
+func (m *MockObjectStorage) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	args := m.Called(ctx, path)
+	var attrs *storage.ObjectAttrs
+	if args.Get(0) != nil {
+		attrs = args.Get(0).(*storage.ObjectAttrs)
+	}
+	return attrs, args.Error(1)
+}
+
+// ListObjects implements the ObjectStore interface
+func (m *MockObjectStorage) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	args := m.Called(ctx, prefix, pageToken, limit)
+	var entries []*storage.ObjectAttrs
+	if args.Get(0) != nil {
+		entries = args.Get(0).([]*storage.ObjectAttrs)
+	}
+	return entries, args.String(1), args.Error(2)
+}
+
 // TestDirectGCSObjectStore tests the GCSObjectStore.GetObject method directly
 func TestDirectGCSObjectStore(t *testing.T) {
 	// Since we can't directly mock the internal bucket.Object() methods,
@@ -241,3 +277,15 @@ type testGCSObjectStoreFunc func(ctx context.Context, path string) (io.ReadClose
 func (f testGCSObjectStoreFunc) GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error) {
 	return f(ctx, path)
 }
+
+func (f testGCSObjectStoreFunc) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	return getObjectAttrsFromFull(f, ctx, path)
+}
+
+func (f testGCSObjectStoreFunc) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return getObjectRangeFromFull(f, ctx, path, offset, length)
+}
+
+func (f testGCSObjectStoreFunc) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	return nil, "", nil
+}
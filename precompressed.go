@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// PrecompressedConfig controls serving precompressed variants stored next to objects
+type PrecompressedConfig struct {
+	Enabled   bool     `toml:"enabled" json:"enabled"`
+	Encodings []string `toml:"encodings" json:"encodings"` // preference order, default: ["br", "gzip"]
+}
+
+// precompressedExtensions maps supported content codings to the suffix of their variant objects
+var precompressedExtensions = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+// defaultPrecompressedEncodings is the server preference when none is configured
+var defaultPrecompressedEncodings = []string{"br", "gzip"}
+
+// acceptedEncoding is a content coding listed in Accept-Encoding
+type acceptedEncoding struct {
+	coding string
+	q      float64
+}
+
+// parseAcceptEncoding parses an Accept-Encoding header into codings with their quality values
+func parseAcceptEncoding(header string) []acceptedEncoding {
+	var accepted []acceptedEncoding
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.ToLower(strings.TrimSpace(name)) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				parsed = 0
+			}
+			q = parsed
+		}
+		accepted = append(accepted, acceptedEncoding{coding: coding, q: q})
+	}
+	return accepted
+}
+
+// negotiateEncodings returns the configured encodings the client accepts, best first.
+// Higher quality values win; ties keep the server's preference order.
+func negotiateEncodings(header string, preference []string) []string {
+	accepted := parseAcceptEncoding(header)
+	if len(accepted) == 0 {
+		return nil
+	}
+
+	quality := func(coding string) float64 {
+		wildcard := -1.0
+		for _, a := range accepted {
+			if a.coding == coding {
+				return a.q
+			}
+			if a.coding == "*" {
+				wildcard = a.q
+			}
+		}
+		if wildcard < 0 {
+			return 0
+		}
+		return wildcard
+	}
+
+	var candidates []string
+	for _, coding := range preference {
+		if _, ok := precompressedExtensions[coding]; ok && quality(coding) > 0 {
+			candidates = append(candidates, coding)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return quality(candidates[i]) > quality(candidates[j])
+	})
+	return candidates
+}
+
+// selectPrecompressedVariant looks for a precompressed variant of path that the client
+// accepts. It sets Vary and, when a variant is found, Content-Encoding, and returns the
+// object path to serve with its attributes. The variant's own name, size and timestamp
+// feed the ETag, so every encoding gets a distinct validator.
+func (s *gcsServer) selectPrecompressedVariant(ctx context.Context, w http.ResponseWriter, r *http.Request, path string, attrs *storage.ObjectAttrs) (string, *storage.ObjectAttrs) {
+	config := &s.headers.Precompressed
+	if !config.Enabled {
+		return path, attrs
+	}
+
+	// The response depends on Accept-Encoding whether or not a variant is chosen
+	addVary(w.Header(), "Accept-Encoding")
+
+	// Objects stored with a Content-Encoding are already encoded
+	if attrs.ContentEncoding != "" {
+		return path, attrs
+	}
+
+	preference := config.Encodings
+	if len(preference) == 0 {
+		preference = defaultPrecompressedEncodings
+	}
+
+	for _, coding := range negotiateEncodings(r.Header.Get("Accept-Encoding"), preference) {
+		variantPath := path + precompressedExtensions[coding]
+
+		gcsStart := time.Now()
+		variantAttrs, err := s.store.GetObjectAttrs(ctx, variantPath)
+		gcsLatency.WithLabelValues(s.bucketName, "get_variant_attrs").Observe(time.Since(gcsStart).Seconds())
+		if err != nil {
+			// Missing or unreadable variants fall back to the next encoding
+			continue
+		}
+
+		served := copyObjectAttrs(variantAttrs)
+		served.ContentType = attrs.ContentType
+		served.ContentEncoding = coding
+		w.Header().Set("Content-Encoding", coding)
+		precompressedResponses.WithLabelValues(s.bucketName, coding).Inc()
+		return variantPath, served
+	}
+
+	precompressedResponses.WithLabelValues(s.bucketName, "identity").Inc()
+	return path, attrs
+}
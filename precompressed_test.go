@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateEncodings(t *testing.T) {
+	preference := []string{"br", "gzip"}
+
+	tests := []struct {
+		name     string
+		header   string
+		expected []string
+	}{
+		{"no header", "", nil},
+		{"browser default", "gzip, deflate, br", []string{"br", "gzip"}},
+		{"gzip only", "gzip", []string{"gzip"}},
+		{"quality values", "br;q=0.5, gzip;q=0.8", []string{"gzip", "br"}},
+		{"explicitly refused", "br;q=0, gzip", []string{"gzip"}},
+		{"wildcard", "*", []string{"br", "gzip"}},
+		{"wildcard with exclusion", "*;q=0.5, br;q=0", []string{"gzip"}},
+		{"identity only", "identity", nil},
+		{"case insensitive", "GZIP", []string{"gzip"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, negotiateEncodings(tt.header, preference))
+		})
+	}
+
+	assert.Equal(t, []string{"gzip", "br"}, negotiateEncodings("br, gzip", []string{"gzip", "br"}), "server preference breaks ties")
+	assert.Equal(t, []string{"gzip"}, negotiateEncodings("zstd, gzip", []string{"zstd", "gzip"}), "unsupported encodings are skipped")
+}
+
+func TestServeHTTP_PrecompressedVariants(t *testing.T) {
+	objects := map[string]mockObject{
+		"app.js":       {data: []byte("console.log('hello world')"), contentType: "application/javascript"},
+		"app.js.br":    {data: []byte("BR-DATA"), contentType: "application/x-brotli"},
+		"app.js.gz":    {data: []byte("GZIP-DATA"), contentType: "application/gzip"},
+		"style.css":    {data: []byte("body{}"), contentType: "text/css"},
+		"style.css.gz": {data: []byte("CSS-GZ"), contentType: "application/gzip"},
+	}
+	headers := getDefaultHeaderConfig()
+	headers.Cache.Enabled = true
+	headers.Precompressed.Enabled = true
+	server := &gcsServer{
+		store:      &mockObjectStore{objects: objects},
+		bucketName: "test-bucket",
+		logger:     &mockLogger{},
+		headers:    headers,
+	}
+
+	serve := func(method, path, acceptEncoding string, extra map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		for k, v := range extra {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	identity := serve(http.MethodGet, "/app.js", "", nil)
+	brotli := serve(http.MethodGet, "/app.js", "gzip, deflate, br", nil)
+	gzipped := serve(http.MethodGet, "/app.js", "gzip", nil)
+
+	t.Run("brotli preferred", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, brotli.Code)
+		assert.Equal(t, "br", brotli.Header().Get("Content-Encoding"))
+		assert.Equal(t, "application/javascript", brotli.Header().Get("Content-Type"))
+		assert.Equal(t, "Accept-Encoding", brotli.Header().Get("Vary"))
+		assert.Equal(t, "BR-DATA", brotli.Body.String())
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		assert.Equal(t, "gzip", gzipped.Header().Get("Content-Encoding"))
+		assert.Equal(t, "GZIP-DATA", gzipped.Body.String())
+	})
+
+	t.Run("identity", func(t *testing.T) {
+		assert.Empty(t, identity.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", identity.Header().Get("Vary"))
+		assert.Equal(t, "console.log('hello world')", identity.Body.String())
+	})
+
+	t.Run("ETag varies per encoding", func(t *testing.T) {
+		etags := map[string]bool{
+			identity.Header().Get("ETag"): true,
+			brotli.Header().Get("ETag"):   true,
+			gzipped.Header().Get("ETag"):  true,
+		}
+		assert.Len(t, etags, 3)
+
+		rr := serve(http.MethodGet, "/app.js", "br", map[string]string{"If-None-Match": brotli.Header().Get("ETag")})
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+
+		rr = serve(http.MethodGet, "/app.js", "gzip", map[string]string{"If-None-Match": brotli.Header().Get("ETag")})
+		assert.Equal(t, http.StatusOK, rr.Code, "a brotli ETag must not validate the gzip variant")
+	})
+
+	t.Run("falls back to available variant", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/style.css", "br, gzip", nil)
+		assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, "CSS-GZ", rr.Body.String())
+	})
+
+	t.Run("HEAD reports variant length", func(t *testing.T) {
+		rr := serve(http.MethodHead, "/app.js", "br", nil)
+		assert.Equal(t, "br", rr.Header().Get("Content-Encoding"))
+		assert.Equal(t, "7", rr.Header().Get("Content-Length"))
+		assert.Empty(t, rr.Body.String())
+	})
+
+	t.Run("ranges apply to the encoded bytes", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/app.js", "br", map[string]string{"Range": "bytes=0-1"})
+		assert.Equal(t, http.StatusPartialContent, rr.Code)
+		assert.Equal(t, "bytes 0-1/7", rr.Header().Get("Content-Range"))
+		assert.Equal(t, "BR", rr.Body.String())
+	})
+
+	t.Run("unsatisfiable range error is not encoded", func(t *testing.T) {
+		rr := serve(http.MethodGet, "/app.js", "br", map[string]string{"Range": "bytes=100-200", "Accept": "application/json"})
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, rr.Code)
+		assert.Equal(t, "bytes */7", rr.Header().Get("Content-Range"))
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Empty(t, rr.Header().Get("ETag"))
+		assert.Empty(t, rr.Header().Get("Cache-Control"))
+		assert.Contains(t, rr.Body.String(), "The requested range cannot be satisfied.")
+	})
+
+	t.Run("variant without original is not served", func(t *testing.T) {
+		objects["orphan.js.gz"] = mockObject{data: []byte("x"), contentType: "application/gzip"}
+		rr := serve(http.MethodGet, "/orphan.js", "gzip", map[string]string{"Accept": "application/json"})
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		headers.Precompressed.Enabled = false
+		defer func() { headers.Precompressed.Enabled = true }()
+
+		rr := serve(http.MethodGet, "/app.js", "br", nil)
+		assert.Empty(t, rr.Header().Get("Content-Encoding"))
+		assert.Empty(t, rr.Header().Get("Vary"))
+		assert.Equal(t, "console.log('hello world')", rr.Body.String())
+	})
+}
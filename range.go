@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/storage"
+)
+
+// maxByteRanges is the most ranges served from one Range header; requests for more
+// are answered with the whole object, since each range costs a backend read
+const maxByteRanges = 50
+
+var (
+	// errInvalidRange marks a Range header that cannot be parsed; such headers are ignored
+	errInvalidRange = errors.New("invalid range")
+	// errUnsatisfiableRange marks a Range header where no range overlaps the object
+	errUnsatisfiableRange = errors.New("requested range not satisfiable")
+)
+
+// byteRange is a satisfiable byte range within an object
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// contentRange formats the range for a Content-Range header
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRangeHeader parses an RFC 7233 "bytes=" Range header against the object size.
+// Ranges that start beyond the end of the object are dropped; if none remain,
+// errUnsatisfiableRange is returned.
+func parseRangeHeader(header string, size int64) ([]byteRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return nil, errInvalidRange
+	}
+
+	var ranges []byteRange
+	noOverlap := false
+	for _, spec := range strings.Split(header[len(prefix):], ",") {
+		spec = textproto.TrimString(spec)
+		if spec == "" {
+			continue
+		}
+
+		startStr, endStr, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, errInvalidRange
+		}
+		startStr, endStr = textproto.TrimString(startStr), textproto.TrimString(endStr)
+
+		var r byteRange
+		if startStr == "" {
+			// Suffix range: the last N bytes of the object
+			if endStr == "" || endStr[0] == '-' {
+				return nil, errInvalidRange
+			}
+			n, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errInvalidRange
+			}
+			if n == 0 || size == 0 {
+				noOverlap = true
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(startStr, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errInvalidRange
+			}
+			if start >= size {
+				noOverlap = true
+				continue
+			}
+			r.start = start
+			if endStr == "" {
+				r.length = size - start
+			} else {
+				end, err := strconv.ParseInt(endStr, 10, 64)
+				if err != nil || start > end {
+					return nil, errInvalidRange
+				}
+				if end >= size {
+					end = size - 1
+				}
+				r.length = end - start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		if noOverlap {
+			return nil, errUnsatisfiableRange
+		}
+		return nil, errInvalidRange
+	}
+	return ranges, nil
+}
+
+// mergeRanges sorts ranges by offset and combines those that overlap or touch, so
+// that each byte is read from the backend once
+func mergeRanges(ranges []byteRange) []byteRange {
+	sorted := make([]byteRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+
+	merged := sorted[:1]
+	for _, ra := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if end := last.start + last.length; ra.start <= end {
+			last.length = max(end, ra.start+ra.length) - last.start
+			continue
+		}
+		merged = append(merged, ra)
+	}
+	return merged
+}
+
+// ifRangeMatches reports whether the If-Range precondition, if any, allows a partial response.
+// Only strong ETags and exact Last-Modified dates match, as required by RFC 7233.
+func ifRangeMatches(r *http.Request, attrs *storage.ObjectAttrs) bool {
+	ifRange := r.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		return ifRange == generateETag(attrs)
+	}
+	if strings.HasPrefix(ifRange, "W/") {
+		return false
+	}
+	t, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	return attrs.Updated.Truncate(time.Second).Equal(t)
+}
+
+// serveRangeRequest serves a 206 or 416 response when the request carries a usable
+// Range header. It returns false when the full object should be served instead.
+// Ranges are read from objectPath, which differs from path for precompressed variants.
+func (s *gcsServer) serveRangeRequest(w *responseWriter, r *http.Request, path, objectPath string, attrs *storage.ObjectAttrs, start time.Time) bool {
+	rangeHeader := r.Header.Get("Range")
+	if rangeHeader == "" || r.Method != http.MethodGet || attrs.Size <= 0 {
+		return false
+	}
+
+	// A changed object invalidates the client's partial copy; send it in full
+	if !ifRangeMatches(r, attrs) {
+		rangeRequests.WithLabelValues(s.bucketName, "if_range_mismatch").Inc()
+		return false
+	}
+
+	ranges, err := parseRangeHeader(rangeHeader, attrs.Size)
+	if err == errUnsatisfiableRange {
+		rangeRequests.WithLabelValues(s.bucketName, "unsatisfiable").Inc()
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", attrs.Size))
+		s.sendUserFriendlyError(
+			w, r, path, http.StatusRequestedRangeNotSatisfiable,
+			"The requested range cannot be satisfied.",
+			err,
+		)
+		return true
+	}
+	if err != nil {
+		rangeRequests.WithLabelValues(s.bucketName, "ignored").Inc()
+		return false
+	}
+
+	// Requests for more bytes than the object holds, or for very many ranges, are
+	// cheaper to serve in full
+	var total int64
+	for _, ra := range ranges {
+		total += ra.length
+	}
+	if total > attrs.Size || len(ranges) > maxByteRanges {
+		rangeRequests.WithLabelValues(s.bucketName, "ignored").Inc()
+		return false
+	}
+	ranges = mergeRanges(ranges)
+
+	var written int64
+	if len(ranges) == 1 {
+		rangeRequests.WithLabelValues(s.bucketName, "single").Inc()
+		written, err = s.writeSingleRange(r.Context(), w, objectPath, attrs, ranges[0])
+	} else {
+		rangeRequests.WithLabelValues(s.bucketName, "multi").Inc()
+		written, err = s.writeMultipleRanges(r.Context(), w, objectPath, attrs, ranges)
+	}
+
+	if err != nil {
+		if !w.written {
+			s.sendStorageError(w, r, path, err)
+			return true
+		}
+		// Headers are already on the wire, so the status cannot change
+		w.statusCode = 500
+		s.logError(logging.Error, "copy_contents", path, http.StatusInternalServerError, err)
+		errorTotal.WithLabelValues(s.bucketName, path, "copy_error").Inc()
+		requestsTotal.WithLabelValues(s.bucketName, path, r.Method, "500").Inc()
+		return true
+	}
+
+	requestsTotal.WithLabelValues(s.bucketName, path, r.Method, "206").Inc()
+	bytesTransferred.WithLabelValues(s.bucketName, path, r.Method, "download").Add(float64(written))
+	s.logInfo("serve_request", path, map[string]any{
+		"status":       206,
+		"bytes_served": written,
+		"ranges":       len(ranges),
+		"content_type": attrs.ContentType,
+		"duration_ms":  time.Since(start).Milliseconds(),
+	})
+	return true
+}
+
+// writeSingleRange streams one byte range as a 206 response
+func (s *gcsServer) writeSingleRange(ctx context.Context, w *responseWriter, path string, attrs *storage.ObjectAttrs, ra byteRange) (int64, error) {
+	gcsStart := time.Now()
+	reader, _, err := s.store.GetObjectRange(ctx, path, ra.start, ra.length)
+	gcsLatency.WithLabelValues(s.bucketName, "get_object_range").Observe(time.Since(gcsStart).Seconds())
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	w.Header().Set("Content-Range", ra.contentRange(attrs.Size))
+	w.Header().Set("Content-Length", strconv.FormatInt(ra.length, 10))
+	w.statusCode = http.StatusPartialContent
+	w.WriteHeader(http.StatusPartialContent)
+
+	return io.Copy(w, reader)
+}
+
+// writeMultipleRanges streams several byte ranges as a multipart/byteranges 206 response
+func (s *gcsServer) writeMultipleRanges(ctx context.Context, w *responseWriter, path string, attrs *storage.ObjectAttrs, ranges []byteRange) (int64, error) {
+	openRange := func(ra byteRange) (io.ReadCloser, error) {
+		gcsStart := time.Now()
+		reader, _, err := s.store.GetObjectRange(ctx, path, ra.start, ra.length)
+		gcsLatency.WithLabelValues(s.bucketName, "get_object_range").Observe(time.Since(gcsStart).Seconds())
+		return reader, err
+	}
+
+	// Open the first range before writing headers so storage errors can still produce an
+	// error page; the others are opened as their parts are written
+	reader, err := openRange(ranges[0])
+	if err != nil {
+		return 0, err
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	w.statusCode = http.StatusPartialContent
+	w.WriteHeader(http.StatusPartialContent)
+
+	var written int64
+	for i, ra := range ranges {
+		if i > 0 {
+			if reader, err = openRange(ra); err != nil {
+				return written, err
+			}
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {attrs.ContentType},
+			"Content-Range": {ra.contentRange(attrs.Size)},
+		})
+		if err != nil {
+			reader.Close()
+			return written, err
+		}
+		n, err := io.Copy(part, reader)
+		reader.Close()
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, mw.Close()
+}
+
+// rangeReadCloser limits reads to a byte range while closing the underlying reader
+type rangeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limitObjectReader skips offset bytes of reader and limits it to length bytes.
+// A negative length reads until the end. It suits stores that cannot seek natively.
+func limitObjectReader(reader io.ReadCloser, offset, length int64) (io.ReadCloser, error) {
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, reader, offset); err != nil && err != io.EOF {
+			reader.Close()
+			return nil, err
+		}
+	}
+	if length < 0 {
+		return reader, nil
+	}
+	return &rangeReadCloser{Reader: io.LimitReader(reader, length), Closer: reader}, nil
+}
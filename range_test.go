@@ -0,0 +1,235 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRangeHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		size     int64
+		expected []byteRange
+		err      error
+	}{
+		{name: "first bytes", header: "bytes=0-4", size: 10, expected: []byteRange{{0, 5}}},
+		{name: "open ended", header: "bytes=6-", size: 10, expected: []byteRange{{6, 4}}},
+		{name: "suffix", header: "bytes=-3", size: 10, expected: []byteRange{{7, 3}}},
+		{name: "suffix longer than object", header: "bytes=-50", size: 10, expected: []byteRange{{0, 10}}},
+		{name: "end clamped to size", header: "bytes=5-100", size: 10, expected: []byteRange{{5, 5}}},
+		{name: "multiple ranges", header: "bytes=0-1, 4-5", size: 10, expected: []byteRange{{0, 2}, {4, 2}}},
+		{name: "unsatisfiable start", header: "bytes=10-", size: 10, err: errUnsatisfiableRange},
+		{name: "zero suffix", header: "bytes=-0", size: 10, err: errUnsatisfiableRange},
+		{name: "partially satisfiable", header: "bytes=20-30,0-0", size: 10, expected: []byteRange{{0, 1}}},
+		{name: "wrong unit", header: "items=0-1", size: 10, err: errInvalidRange},
+		{name: "missing dash", header: "bytes=5", size: 10, err: errInvalidRange},
+		{name: "reversed", header: "bytes=5-1", size: 10, err: errInvalidRange},
+		{name: "not a number", header: "bytes=a-b", size: 10, err: errInvalidRange},
+		{name: "empty set", header: "bytes=", size: 10, err: errInvalidRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges, err := parseRangeHeader(tt.header, tt.size)
+			if tt.err != nil {
+				assert.Equal(t, tt.err, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ranges)
+		})
+	}
+}
+
+func TestMergeRanges(t *testing.T) {
+	assert.Equal(t, []byteRange{{0, 2}, {4, 2}}, mergeRanges([]byteRange{{4, 2}, {0, 2}}))
+	assert.Equal(t, []byteRange{{0, 4}}, mergeRanges([]byteRange{{0, 2}, {2, 2}}), "adjacent ranges")
+	assert.Equal(t, []byteRange{{0, 6}}, mergeRanges([]byteRange{{0, 4}, {1, 1}, {3, 3}}), "overlapping ranges")
+}
+
+func TestIfRangeMatches(t *testing.T) {
+	updated := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	attrs := &storage.ObjectAttrs{Name: "video.mp4", Size: 10, Updated: updated}
+	etag := generateETag(attrs)
+
+	tests := []struct {
+		name     string
+		ifRange  string
+		expected bool
+	}{
+		{"no header", "", true},
+		{"matching etag", etag, true},
+		{"stale etag", `"stale"`, false},
+		{"weak etag never matches", "W/" + etag, false},
+		{"matching date", updated.Format(http.TimeFormat), true},
+		{"older date", updated.Add(-time.Hour).Format(http.TimeFormat), false},
+		{"garbage", "yesterday", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/video.mp4", nil)
+			if tt.ifRange != "" {
+				req.Header.Set("If-Range", tt.ifRange)
+			}
+			assert.Equal(t, tt.expected, ifRangeMatches(req, attrs))
+		})
+	}
+}
+
+func TestServeHTTP_RangeRequests(t *testing.T) {
+	objects := map[string]mockObject{
+		"video.mp4": {data: []byte("0123456789"), contentType: "video/mp4"},
+	}
+	server := createMockServer(t, objects, nil)
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/video.mp4", nil)
+		req.Header.Set("Accept", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("full response advertises ranges", func(t *testing.T) {
+		rr := serve(nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "bytes", rr.Header().Get("Accept-Ranges"))
+		assert.Equal(t, "0123456789", rr.Body.String())
+	})
+
+	t.Run("single range", func(t *testing.T) {
+		rr := serve(map[string]string{"Range": "bytes=2-5"})
+		assert.Equal(t, http.StatusPartialContent, rr.Code)
+		assert.Equal(t, "bytes 2-5/10", rr.Header().Get("Content-Range"))
+		assert.Equal(t, "4", rr.Header().Get("Content-Length"))
+		assert.Equal(t, "video/mp4", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "2345", rr.Body.String())
+	})
+
+	t.Run("suffix range", func(t *testing.T) {
+		rr := serve(map[string]string{"Range": "bytes=-2"})
+		assert.Equal(t, http.StatusPartialContent, rr.Code)
+		assert.Equal(t, "bytes 8-9/10", rr.Header().Get("Content-Range"))
+		assert.Equal(t, "89", rr.Body.String())
+	})
+
+	t.Run("multiple ranges", func(t *testing.T) {
+		rr := serve(map[string]string{"Range": "bytes=0-1,7-8"})
+		assert.Equal(t, http.StatusPartialContent, rr.Code)
+
+		mediaType, params, err := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+		require.NoError(t, err)
+		assert.Equal(t, "multipart/byteranges", mediaType)
+
+		mr := multipart.NewReader(strings.NewReader(rr.Body.String()), params["boundary"])
+		var bodies, contentRanges []string
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			data, err := io.ReadAll(part)
+			require.NoError(t, err)
+			bodies = append(bodies, string(data))
+			contentRanges = append(contentRanges, part.Header.Get("Content-Range"))
+			assert.Equal(t, "video/mp4", part.Header.Get("Content-Type"))
+		}
+		assert.Equal(t, []string{"01", "78"}, bodies)
+		assert.Equal(t, []string{"bytes 0-1/10", "bytes 7-8/10"}, contentRanges)
+	})
+
+	t.Run("unsatisfiable range", func(t *testing.T) {
+		rr := serve(map[string]string{"Range": "bytes=50-60"})
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, rr.Code)
+		assert.Equal(t, "bytes */10", rr.Header().Get("Content-Range"))
+	})
+
+	t.Run("invalid range is ignored", func(t *testing.T) {
+		rr := serve(map[string]string{"Range": "bytes=abc"})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "0123456789", rr.Body.String())
+	})
+
+	t.Run("overlapping ranges larger than object are served in full", func(t *testing.T) {
+		rr := serve(map[string]string{"Range": "bytes=0-9,0-9"})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "0123456789", rr.Body.String())
+	})
+
+	t.Run("adjacent ranges are merged", func(t *testing.T) {
+		rr := serve(map[string]string{"Range": "bytes=4-5,0-1,2-3"})
+		assert.Equal(t, http.StatusPartialContent, rr.Code)
+		assert.Equal(t, "bytes 0-5/10", rr.Header().Get("Content-Range"))
+		assert.Equal(t, "012345", rr.Body.String())
+	})
+
+	t.Run("too many ranges are served in full", func(t *testing.T) {
+		specs := make([]string, maxByteRanges+1)
+		for i := range specs {
+			specs[i] = "0-0"
+		}
+		rr := serve(map[string]string{"Range": "bytes=" + strings.Join(specs, ",")})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "0123456789", rr.Body.String())
+	})
+
+	t.Run("stale If-Range serves full object", func(t *testing.T) {
+		rr := serve(map[string]string{"Range": "bytes=2-5", "If-Range": `"outdated"`})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "0123456789", rr.Body.String())
+	})
+
+	t.Run("range ignored for other methods", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/video.mp4", nil)
+		req.Header.Set("Range", "bytes=2-5")
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestLimitObjectReader(t *testing.T) {
+	reader, err := limitObjectReader(io.NopCloser(strings.NewReader("abcdefgh")), 2, 3)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(reader)
+	assert.Equal(t, "cde", string(data))
+
+	reader, err = limitObjectReader(io.NopCloser(strings.NewReader("abcdefgh")), 5, -1)
+	require.NoError(t, err)
+	data, _ = io.ReadAll(reader)
+	assert.Equal(t, "fgh", string(data))
+}
+
+func TestServeHTTP_MultipleRangesOpenOneReadEach(t *testing.T) {
+	store := &countingObjectStore{mockObjectStore: mockObjectStore{objects: map[string]mockObject{
+		"video.mp4": {data: []byte("0123456789"), contentType: "video/mp4"},
+	}}}
+	server := &gcsServer{store: store, bucketName: "test-bucket", logger: &mockLogger{}, headers: getDefaultHeaderConfig()}
+
+	req := httptest.NewRequest(http.MethodGet, "/video.mp4", nil)
+	req.Header.Set("Range", "bytes=0-0,1-1,2-2,5-5,6-7,9-9")
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Contains(t, rr.Body.String(), "bytes 0-2/10")
+	assert.Contains(t, rr.Body.String(), "bytes 5-7/10")
+	assert.Contains(t, rr.Body.String(), "bytes 9-9/10")
+	assert.Equal(t, 3, store.bodyOpens, "one backend read per merged range")
+}
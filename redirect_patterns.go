@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// splatSegment matches the rest of the path; it is available as :splat in destinations
+	splatSegment = "*"
+	// splatParam is the destination placeholder replaced by the text matched by splatSegment
+	splatParam = "splat"
+)
+
+var (
+	// destinationPlaceholder matches :name placeholders in redirect destinations
+	destinationPlaceholder = regexp.MustCompile(`:([A-Za-z_][A-Za-z0-9_]*)`)
+	// placeholderSegment matches a path segment that is a single :name placeholder
+	placeholderSegment = regexp.MustCompile(`^:[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// redirectPattern is a compiled redirect rule containing placeholders, a splat or
+// query conditions
+type redirectPattern struct {
+	path          string            // rule path as cleaned by cleanRedirectPath, including any query
+	segments      []string          // literal segments, :name placeholders and a trailing *
+	literalPrefix int               // length of the path before the first placeholder, used for precedence
+	literal       bool              // the path has no placeholders, only query conditions
+	query         map[string]string // required query parameters: a value, a :name placeholder or "" for any
+	rule          RedirectRule
+}
+
+// isRedirectPattern reports whether a cleaned redirect path contains placeholders,
+// a splat or query conditions
+func isRedirectPattern(path string) bool {
+	path, _, hasQuery := strings.Cut(path, "?")
+	if hasQuery {
+		return true
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == splatSegment || strings.HasPrefix(segment, ":") {
+			return true
+		}
+	}
+	return false
+}
+
+// compileRedirectPattern parses a cleaned redirect path such as "blog/*",
+// "docs/:version/*" or "search?q=:term"
+func compileRedirectPattern(path string, rule RedirectRule) (redirectPattern, error) {
+	pathPart, rawQuery, _ := strings.Cut(path, "?")
+	segments := strings.Split(strings.TrimSuffix(pathPart, "/"), "/")
+	literalPrefix := -1
+	offset := 0
+	names := make(map[string]bool)
+
+	for i, segment := range segments {
+		switch {
+		case segment == splatSegment:
+			if i != len(segments)-1 {
+				return redirectPattern{}, fmt.Errorf("invalid redirect pattern %q: * must be the last segment", path)
+			}
+		case strings.Contains(segment, splatSegment):
+			return redirectPattern{}, fmt.Errorf("invalid redirect pattern %q: * must be a whole segment", path)
+		case strings.HasPrefix(segment, ":"):
+			name := segment[1:]
+			if !placeholderSegment.MatchString(segment) {
+				return redirectPattern{}, fmt.Errorf("invalid redirect pattern %q: bad placeholder %q", path, segment)
+			}
+			if name == splatParam || names[name] {
+				return redirectPattern{}, fmt.Errorf("invalid redirect pattern %q: duplicate placeholder %q", path, segment)
+			}
+			names[name] = true
+		default:
+			offset += len(segment) + 1
+			continue
+		}
+		if literalPrefix < 0 {
+			literalPrefix = offset
+		}
+		offset += len(segment) + 1
+	}
+
+	literal := literalPrefix < 0
+	if literal {
+		literalPrefix = len(pathPart)
+	}
+
+	query, err := compileQueryConditions(path, rawQuery, names)
+	if err != nil {
+		return redirectPattern{}, err
+	}
+
+	return redirectPattern{
+		path:          path,
+		segments:      segments,
+		literalPrefix: literalPrefix,
+		literal:       literal,
+		query:         query,
+		rule:          rule,
+	}, nil
+}
+
+// compileQueryConditions parses the query part of a rule path into required parameters.
+// names holds the placeholders already used by the path.
+func compileQueryConditions(path, rawQuery string, names map[string]bool) (map[string]string, error) {
+	if rawQuery == "" {
+		return nil, nil
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect pattern %q: %v", path, err)
+	}
+
+	query := make(map[string]string, len(values))
+	for key, vals := range values {
+		if len(vals) > 1 {
+			return nil, fmt.Errorf("invalid redirect pattern %q: query parameter %q is repeated", path, key)
+		}
+		value := vals[0]
+		if strings.HasPrefix(value, ":") {
+			name := value[1:]
+			if !placeholderSegment.MatchString(value) {
+				return nil, fmt.Errorf("invalid redirect pattern %q: bad placeholder %q", path, value)
+			}
+			if name == splatParam || names[name] {
+				return nil, fmt.Errorf("invalid redirect pattern %q: duplicate placeholder %q", path, value)
+			}
+			names[name] = true
+		}
+		query[key] = value
+	}
+	return query, nil
+}
+
+// compileRedirectPatterns compiles every pattern rule in redirects, ordered by precedence:
+// literal paths first, then the longest literal prefix, then the most query conditions,
+// then the most segments, then the path itself.
+func compileRedirectPatterns(redirects map[string]RedirectRule) ([]redirectPattern, error) {
+	var patterns []redirectPattern
+	for path, rule := range redirects {
+		if !isRedirectPattern(path) {
+			continue
+		}
+		pattern, err := compileRedirectPattern(path, rule)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	sortRedirectPatterns(patterns)
+	return patterns, nil
+}
+
+// sortRedirectPatterns orders patterns by precedence
+func sortRedirectPatterns(patterns []redirectPattern) {
+	sort.Slice(patterns, func(i, j int) bool {
+		a, b := patterns[i], patterns[j]
+		if a.literal != b.literal {
+			return a.literal
+		}
+		if a.literalPrefix != b.literalPrefix {
+			return a.literalPrefix > b.literalPrefix
+		}
+		if len(a.query) != len(b.query) {
+			return len(a.query) > len(b.query)
+		}
+		if len(a.segments) != len(b.segments) {
+			return len(a.segments) > len(b.segments)
+		}
+		return a.path < b.path
+	})
+}
+
+// match matches a request path (without leading slash) and query against the
+// pattern and returns the placeholder values
+func (p redirectPattern) match(path string, query url.Values) (map[string]string, bool) {
+	parts := strings.Split(path, "/")
+	params := make(map[string]string)
+
+	for name, want := range p.query {
+		values, ok := query[name]
+		if !ok {
+			return nil, false
+		}
+		switch got := values[0]; {
+		case strings.HasPrefix(want, ":"):
+			if got == "" {
+				return nil, false
+			}
+			params[want[1:]] = got
+		case want != "" && got != want:
+			return nil, false
+		}
+	}
+
+	for i, segment := range p.segments {
+		if segment == splatSegment {
+			// A splat also matches the bare parent path, e.g. "blog/*" matches "blog"
+			params[splatParam] = strings.Join(parts[min(i, len(parts)):], "/")
+			return params, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		if strings.HasPrefix(segment, ":") {
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[segment[1:]] = parts[i]
+			continue
+		}
+		if segment != parts[i] {
+			return nil, false
+		}
+	}
+
+	// Without a splat the whole path must be consumed; a trailing slash is ignored
+	rest := parts[len(p.segments):]
+	return params, len(rest) == 0 || (len(rest) == 1 && rest[0] == "")
+}
+
+// expandRedirectURL substitutes placeholders in a redirect destination with the values
+// escaped for where they appear: path escaping before the query and query escaping in
+// it. Captured values are decoded, so unescaped they could add a query, a fragment or,
+// with a leading backslash, a host to the destination.
+func expandRedirectURL(destination string, params map[string]string) string {
+	pathEscaped := make(map[string]string, len(params))
+	queryEscaped := make(map[string]string, len(params))
+	for name, value := range params {
+		pathEscaped[name] = url.PathEscape(value)
+		queryEscaped[name] = url.QueryEscape(value)
+	}
+	if splat, ok := params[splatParam]; ok {
+		// The splat spans segments; keep its slashes
+		parts := strings.Split(splat, "/")
+		for i, part := range parts {
+			parts[i] = url.PathEscape(part)
+		}
+		pathEscaped[splatParam] = strings.Join(parts, "/")
+	}
+
+	pathPart, query, hasQuery := strings.Cut(destination, "?")
+	expanded := expandRedirectDestination(pathPart, pathEscaped)
+	if hasQuery {
+		expanded += "?" + expandRedirectDestination(query, queryEscaped)
+	}
+	return expanded
+}
+
+// expandRedirectDestination substitutes :name and :splat placeholders in a destination.
+// Placeholders without a value are left untouched.
+func expandRedirectDestination(destination string, params map[string]string) string {
+	return destinationPlaceholder.ReplaceAllStringFunc(destination, func(placeholder string) string {
+		if value, ok := params[placeholder[1:]]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// redirectMatchPath returns the path redirect rules are matched against: the cleaned
+// request path without the index.html that cleanRequestPath adds for directories
+func redirectMatchPath(requestPath, cleanPath string) string {
+	if strings.HasSuffix(requestPath, "/") {
+		return strings.TrimSuffix(cleanPath, "index.html")
+	}
+	return cleanPath
+}
+
+// findRedirect resolves the redirect for a request. Exact rules with query conditions
+// win over the plain exact rule, which wins over placeholder patterns; patterns are
+// tried in precedence order. It returns the matched rule path and the rule with its
+// placeholders expanded.
+func (s *gcsServer) findRedirect(r *http.Request, cleanPath string) (string, RedirectRule, bool) {
+	matchPath := redirectMatchPath(r.URL.Path, cleanPath)
+	query := r.URL.Query()
+	exactChecked := false
+
+	for _, pattern := range s.redirectPatterns {
+		if !pattern.literal && !exactChecked {
+			exactChecked = true
+			if rule, exists := s.exactRedirect(cleanPath); exists {
+				return cleanPath, rule, true
+			}
+		}
+		if params, ok := pattern.match(matchPath, query); ok {
+			rule := pattern.rule
+			rule.To = expandRedirectURL(rule.To, params)
+			return pattern.path, rule, true
+		}
+	}
+
+	if !exactChecked {
+		if rule, exists := s.exactRedirect(cleanPath); exists {
+			return cleanPath, rule, true
+		}
+	}
+	return "", RedirectRule{}, false
+}
+
+// exactRedirect returns the rule for a path without placeholders or query conditions
+func (s *gcsServer) exactRedirect(cleanPath string) (RedirectRule, bool) {
+	// Pattern rules are also stored in the map, so a literal "/blog/*" request must not match them exactly
+	rule, exists := s.redirects[cleanPath]
+	return rule, exists && !isRedirectPattern(cleanPath)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileRedirectPattern(t *testing.T) {
+	pattern, err := compileRedirectPattern("docs/:version/*", RedirectRule{To: "https://docs.example.com/:version/:splat"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs", ":version", "*"}, pattern.segments)
+	assert.Equal(t, len("docs/"), pattern.literalPrefix)
+
+	invalid := []string{
+		"blog/*/posts",
+		"blog/post*",
+		"docs/:version/:version",
+		"docs/:splat",
+		"docs/:1version",
+		"docs/:",
+	}
+	for _, path := range invalid {
+		t.Run(path, func(t *testing.T) {
+			_, err := compileRedirectPattern(path, RedirectRule{To: "https://example.com"})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRedirectPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		params  map[string]string
+		matched bool
+	}{
+		{"blog/*", "blog/2024/hello", map[string]string{"splat": "2024/hello"}, true},
+		{"blog/*", "blog/", map[string]string{"splat": ""}, true},
+		{"blog/*", "blog", map[string]string{"splat": ""}, true},
+		{"blog/*", "blogs/hello", nil, false},
+		{"users/:id", "users/42", map[string]string{"id": "42"}, true},
+		{"users/:id", "users/42/", map[string]string{"id": "42"}, true},
+		{"users/:id", "users/42/posts", nil, false},
+		{"users/:id", "users/", nil, false},
+		{"docs/:version/*", "docs/v2/guide/intro", map[string]string{"version": "v2", "splat": "guide/intro"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			pattern, err := compileRedirectPattern(tt.pattern, RedirectRule{})
+			require.NoError(t, err)
+			params, ok := pattern.match(tt.path, nil)
+			assert.Equal(t, tt.matched, ok)
+			if tt.matched {
+				assert.Equal(t, tt.params, params)
+			}
+		})
+	}
+}
+
+func TestCompileRedirectPatterns_Precedence(t *testing.T) {
+	patterns, err := compileRedirectPatterns(map[string]RedirectRule{
+		"exact":              {To: "https://example.com/exact"},
+		"*":                  {To: "https://example.com/:splat"},
+		"blog/*":             {To: "https://example.com/blog/:splat"},
+		"blog/2024/*":        {To: "https://example.com/2024/:splat"},
+		"blog/:year/:slug":   {To: "https://example.com/:year/:slug"},
+		"blog/:year/archive": {To: "https://example.com/archive/:year"},
+	})
+	require.NoError(t, err)
+
+	var order []string
+	for _, p := range patterns {
+		order = append(order, p.path)
+	}
+	assert.Equal(t, []string{"blog/2024/*", "blog/:year/:slug", "blog/:year/archive", "blog/*", "*"}, order)
+}
+
+func TestExpandRedirectDestination(t *testing.T) {
+	params := map[string]string{"splat": "a/b", "id": "7"}
+	assert.Equal(t, "https://example.com/new/a/b?id=7", expandRedirectDestination("https://example.com/new/:splat?id=:id", params))
+	assert.Equal(t, "https://example.com:8443/:missing", expandRedirectDestination("https://example.com:8443/:missing", params))
+}
+
+func TestServeHTTP_RedirectPatterns(t *testing.T) {
+	const bucket = "redirect-patterns-bucket"
+	redirects := map[string]RedirectRule{
+		"blog/*":          {To: "https://blog.example.com/:splat"},
+		"blog/2024/*":     {To: "https://archive.example.com/2024/:splat"},
+		"blog/featured":   {To: "https://example.com/featured"},
+		"users/:id":       {To: "https://example.com/profile/:id"},
+		"docs/:version/*": {To: "https://docs.example.com/:version/:splat"},
+	}
+	server, err := newGCSServer(context.Background(), bucket, &mockLogger{}, &mockObjectStore{objects: map[string]mockObject{}}, redirects, nil, nil)
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"/blog/hello":                 "https://blog.example.com/hello",
+		"/blog/2023/01/post":          "https://blog.example.com/2023/01/post",
+		"/blog/2024/01/post":          "https://archive.example.com/2024/01/post",
+		"/blog/featured":              "https://example.com/featured",
+		"/blog/":                      "https://blog.example.com/",
+		"/users/42":                   "https://example.com/profile/42",
+		"/docs/v3/guide/install.html": "https://docs.example.com/v3/guide/install.html",
+	}
+	for path, location := range tests {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusFound, rr.Code)
+			assert.Equal(t, location, rr.Header().Get("Location"))
+		})
+	}
+
+	t.Run("captured values are escaped", func(t *testing.T) {
+		escaping, err := newGCSServer(context.Background(), bucket, &mockLogger{}, &mockObjectStore{objects: map[string]mockObject{}}, map[string]RedirectRule{
+			"blog/*":    {To: "https://new.example.com/posts/:splat"},
+			"go/*":      {To: "/:splat"},
+			"users/:id": {To: "/profile/:id"},
+		}, nil, nil)
+		require.NoError(t, err)
+
+		for path, location := range map[string]string{
+			"/blog/a%3Fb%23c":   "https://new.example.com/posts/a%3Fb%23c",
+			"/blog/x/a%23b/y":   "https://new.example.com/posts/x/a%23b/y",
+			"/go/%5Cevil.com":   "/%5Cevil.com",
+			"/users/1%3Fadmin":  "/profile/1%3Fadmin",
+			"/users/%5C%5Chost": "/profile/%5C%5Chost",
+		} {
+			rr := httptest.NewRecorder()
+			escaping.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+			assert.Equal(t, location, rr.Header().Get("Location"), path)
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users/42/posts", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("metrics are labelled by rule", func(t *testing.T) {
+		before := testutil.ToFloat64(redirectHits.WithLabelValues(bucket, "users/:id", "https://example.com/profile/:id", "302"))
+		for _, path := range []string{"/users/1", "/users/2"} {
+			server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		}
+		assert.Equal(t, before+2, testutil.ToFloat64(redirectHits.WithLabelValues(bucket, "users/:id", "https://example.com/profile/:id", "302")))
+	})
+}
+
+func TestNewGCSServer_InvalidRedirectPattern(t *testing.T) {
+	_, err := newGCSServer(context.Background(), "test-bucket", &mockLogger{}, &mockObjectStore{}, map[string]RedirectRule{"blog/*/x": {To: "https://example.com"}}, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestLoadRedirects_Patterns(t *testing.T) {
+	store := &mockRedirectStore{content: "[redirects]\n\"/blog/*\" = \"https://blog.example.com/:splat\"\n"}
+	redirects, _, err := loadRedirects(context.Background(), store)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]RedirectRule{"blog/*": {To: "https://blog.example.com/:splat"}}, redirects)
+
+	before := testutil.ToFloat64(redirectConfigErrors.WithLabelValues("", "invalid_pattern"))
+	store = &mockRedirectStore{content: "[redirects]\n\"/blog/*/x\" = \"https://example.com\"\n"}
+	_, _, err = loadRedirects(context.Background(), store)
+	assert.Error(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(redirectConfigErrors.WithLabelValues("", "invalid_pattern")))
+}
+
+func TestRedirectPatternMatch_Query(t *testing.T) {
+	pattern, err := compileRedirectPattern("search?q=:term&lang=en&ref", RedirectRule{})
+	require.NoError(t, err)
+	assert.True(t, pattern.literal)
+	assert.Equal(t, map[string]string{"q": ":term", "lang": "en", "ref": ""}, pattern.query)
+
+	params, ok := pattern.match("search", url.Values{"q": {"go modules"}, "lang": {"en"}, "ref": {"x"}, "extra": {"1"}})
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"term": "go modules"}, params)
+
+	_, ok = pattern.match("search", url.Values{"q": {"go"}, "lang": {"de"}, "ref": {""}})
+	assert.False(t, ok, "fixed values must match")
+	_, ok = pattern.match("search", url.Values{"q": {""}, "lang": {"en"}, "ref": {""}})
+	assert.False(t, ok, "placeholders need a value")
+	_, ok = pattern.match("search", url.Values{"q": {"go"}, "lang": {"en"}})
+	assert.False(t, ok, "presence conditions need the parameter")
+
+	for _, path := range []string{"search?q=:term&q=:other", "search?q=:1", "users/:id?id=:id", "search?q=%zz"} {
+		_, err := compileRedirectPattern(path, RedirectRule{})
+		assert.Error(t, err, path)
+	}
+}
+
+func TestRedirectRuleLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     RedirectRule
+		rawQuery string
+		expected string
+	}{
+		{"drop by default", RedirectRule{To: "https://example.com/new"}, "utm_source=x", "https://example.com/new"},
+		{"drop keeps destination query", RedirectRule{To: "https://example.com/new?a=1", Query: "drop"}, "utm_source=x", "https://example.com/new?a=1"},
+		{"preserve", RedirectRule{To: "https://example.com/new", Query: "preserve"}, "utm_source=x&b=2", "https://example.com/new?utm_source=x&b=2"},
+		{"preserve replaces destination query", RedirectRule{To: "https://example.com/new?a=1", Query: "preserve"}, "utm_source=x", "https://example.com/new?utm_source=x"},
+		{"preserve without incoming query", RedirectRule{To: "https://example.com/new?a=1", Query: "preserve"}, "", "https://example.com/new?a=1"},
+		{"merge", RedirectRule{To: "https://example.com/new?a=1", Query: "merge"}, "utm_source=x&a=2", "https://example.com/new?a=1&utm_source=x"},
+		{"merge into empty destination query", RedirectRule{To: "https://example.com/new", Query: "merge"}, "utm_source=x", "https://example.com/new?utm_source=x"},
+		{"fragment is kept", RedirectRule{To: "https://example.com/new#top", Query: "preserve"}, "a=1", "https://example.com/new?a=1#top"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.rule.location(tt.rawQuery))
+		})
+	}
+}
+
+func TestServeHTTP_RedirectQuery(t *testing.T) {
+	redirects := map[string]RedirectRule{
+		"old":                        {To: "https://example.com/new"},
+		"campaign":                   {To: "https://example.com/landing", Query: queryModePreserve},
+		"promo":                      {To: "https://example.com/sale?utm_medium=web", Query: queryModeMerge},
+		"products?id=42":             {To: "https://example.com/products/answer"},
+		"products?id=:id":            {To: "https://example.com/products/:id"},
+		"products":                   {To: "https://example.com/catalog"},
+		"search?q=:term":             {To: "https://search.example.com/?query=:term"},
+		"find?q=:term":               {To: "/find/:term"},
+		"tags/:tag":                  {To: "/search?tag=:tag"},
+		"docs/*?version=:version":    {To: "https://docs.example.com/:version/:splat"},
+		"docs/*":                     {To: "https://docs.example.com/latest/:splat"},
+		"legacy?format=rss":          {To: "https://example.com/feed.xml", Status: http.StatusMovedPermanently},
+		"legacy?format=rss&full=yes": {To: "https://example.com/feed-full.xml"},
+	}
+	server, err := newGCSServer(context.Background(), "redirect-query-bucket", &mockLogger{}, &mockObjectStore{objects: map[string]mockObject{}}, redirects, nil, nil)
+	require.NoError(t, err)
+
+	tests := map[string]string{
+		"/old?utm_source=x":                "https://example.com/new",
+		"/campaign?utm_source=newsletter":  "https://example.com/landing?utm_source=newsletter",
+		"/promo?utm_source=x&utm_medium=y": "https://example.com/sale?utm_medium=web&utm_source=x",
+		"/products?id=42":                  "https://example.com/products/answer",
+		"/products?id=7":                   "https://example.com/products/7",
+		"/products":                        "https://example.com/catalog",
+		"/search?q=a%26b":                  "https://search.example.com/?query=a%26b",
+		"/search?q=a+b":                    "https://search.example.com/?query=a+b",
+		"/find?q=a+b":                      "/find/a%20b",
+		"/find?q=a/b%3Fc":                  "/find/a%2Fb%3Fc",
+		"/tags/a&b=c":                      "/search?tag=a%26b%3Dc",
+		"/docs/guide/intro?version=v2":     "https://docs.example.com/v2/guide/intro",
+		"/docs/guide/intro":                "https://docs.example.com/latest/guide/intro",
+		"/legacy?format=rss&full=yes":      "https://example.com/feed-full.xml",
+	}
+	for path, location := range tests {
+		t.Run(path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+			assert.Equal(t, location, rr.Header().Get("Location"))
+		})
+	}
+
+	t.Run("unmatched query condition", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/legacy?format=atom", nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestLoadRedirects_Query(t *testing.T) {
+	content := `[redirects]
+"/campaign" = { to = "https://example.com/landing", query = "preserve" }
+"/products?id=:id" = "https://example.com/products/:id"
+`
+	redirects, _, err := loadRedirects(context.Background(), &mockRedirectStore{content: content})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]RedirectRule{
+		"campaign":        {To: "https://example.com/landing", Query: "preserve"},
+		"products?id=:id": {To: "https://example.com/products/:id"},
+	}, redirects)
+
+	before := testutil.ToFloat64(redirectConfigErrors.WithLabelValues("", "invalid_query"))
+	_, _, err = loadRedirects(context.Background(), &mockRedirectStore{content: `redirects = { "/a" = { to = "https://example.com", query = "keep" } }`})
+	assert.Error(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(redirectConfigErrors.WithLabelValues("", "invalid_query")))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Query modes control what happens to the incoming query string on redirect
+const (
+	queryModeDrop     = "drop"     // use the destination as written (default)
+	queryModePreserve = "preserve" // replace the destination's query with the incoming one
+	queryModeMerge    = "merge"    // add incoming parameters the destination does not set
+)
+
+// validQueryModes are the values accepted for a rule's query option
+var validQueryModes = map[string]bool{
+	queryModeDrop:     true,
+	queryModePreserve: true,
+	queryModeMerge:    true,
+}
+
+// validRedirectStatuses are the status codes a redirect rule may use
+var validRedirectStatuses = map[int]bool{
+	http.StatusMovedPermanently:  true,
+	http.StatusFound:             true,
+	http.StatusTemporaryRedirect: true,
+	http.StatusPermanentRedirect: true,
+}
+
+// RedirectRule is a single entry of redirects.toml. It is written either as a
+// destination string or as a table with `to` and the optional `status` and `query`.
+type RedirectRule struct {
+	To     string `toml:"to" json:"to"`
+	Status int    `toml:"status" json:"status,omitempty"` // 301, 302, 307 or 308; default 302
+	Query  string `toml:"query" json:"query,omitempty"`   // drop, preserve or merge; default drop
+}
+
+// UnmarshalTOML accepts both the "path" = "url" and "path" = { to = "url", status = 301 } forms
+func (r *RedirectRule) UnmarshalTOML(data any) error {
+	switch value := data.(type) {
+	case string:
+		r.To = value
+		return nil
+	case map[string]any:
+		for key, field := range value {
+			switch key {
+			case "to":
+				to, ok := field.(string)
+				if !ok {
+					return fmt.Errorf("redirect field \"to\" must be a string")
+				}
+				r.To = to
+			case "status":
+				status, ok := field.(int64)
+				if !ok {
+					return fmt.Errorf("redirect field \"status\" must be an integer")
+				}
+				r.Status = int(status)
+			case "query":
+				query, ok := field.(string)
+				if !ok {
+					return fmt.Errorf("redirect field \"query\" must be a string")
+				}
+				r.Query = query
+			default:
+				return fmt.Errorf("unknown redirect field %q", key)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("redirect must be a URL string or a table, got %T", data)
+	}
+}
+
+// statusCode returns the status code the rule redirects with
+func (r RedirectRule) statusCode() int {
+	if r.Status == 0 {
+		return http.StatusFound
+	}
+	return r.Status
+}
+
+// location returns the Location header for the rule, applying its query mode to
+// the incoming raw query string
+func (r RedirectRule) location(rawQuery string) string {
+	if rawQuery == "" || r.Query == "" || r.Query == queryModeDrop {
+		return r.To
+	}
+
+	destination, err := url.Parse(r.To)
+	if err != nil {
+		return r.To
+	}
+
+	switch r.Query {
+	case queryModePreserve:
+		destination.RawQuery = rawQuery
+	case queryModeMerge:
+		incoming, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return r.To
+		}
+		if destination.RawQuery == "" {
+			destination.RawQuery = rawQuery
+			break
+		}
+		merged := destination.Query()
+		for key, values := range incoming {
+			if _, exists := merged[key]; !exists {
+				merged[key] = values
+			}
+		}
+		destination.RawQuery = merged.Encode()
+	}
+	return destination.String()
+}
+
+// redirectDestinations returns the destination of every rule, keyed by path
+func redirectDestinations(redirects map[string]RedirectRule) map[string]string {
+	destinations := make(map[string]string, len(redirects))
+	for path, rule := range redirects {
+		destinations[path] = rule.To
+	}
+	return destinations
+}
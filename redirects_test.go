@@ -3,13 +3,17 @@ package main
 import (
 	"context"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"cloud.google.com/go/storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // mockRedirectStore implements ObjectStore for testing redirects
@@ -35,6 +39,18 @@ func (m *mockRedirectStore) GetObject(ctx context.Context, path string) (io.Read
 	return nil, nil, storage.ErrObjectNotExist
 }
 
+func (m *mockRedirectStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return getObjectRangeFromFull(m, ctx, path, offset, length)
+}
+
+func (m *mockRedirectStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	return getObjectAttrsFromFull(m, ctx, path)
+}
+
+func (m *mockRedirectStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	return listMockObjects(m.objects, prefix, pageToken, limit)
+}
+
 func TestLoadRedirects(t *testing.T) {
 	// Load the static TOML fixture
 	content, err := os.ReadFile("testdata/redirects.toml")
@@ -45,13 +61,13 @@ func TestLoadRedirects(t *testing.T) {
 	tests := []struct {
 		name          string
 		content       string
-		expected      map[string]string
+		expected      map[string]RedirectRule
 		expectedError bool
 	}{
 		{
 			name:          "valid_redirects",
 			content:       string(content),
-			expected:      map[string]string{"old-path": "https://example.com/new-path", "another-path": "https://example.com/destination"},
+			expected:      map[string]RedirectRule{"old-path": {To: "https://example.com/new-path"}, "another-path": {To: "https://example.com/destination"}},
 			expectedError: false,
 		},
 		{
@@ -69,7 +85,7 @@ func TestLoadRedirects(t *testing.T) {
 		{
 			name:          "empty_file",
 			content:       "",
-			expected:      map[string]string{},
+			expected:      map[string]RedirectRule{},
 			expectedError: false,
 		},
 	}
@@ -81,7 +97,7 @@ func TestLoadRedirects(t *testing.T) {
 			defer os.Unsetenv("BUCKET_NAME")
 
 			store := &mockRedirectStore{content: tt.content}
-			redirects, err := loadRedirects(context.Background(), store)
+			redirects, _, err := loadRedirects(context.Background(), store)
 
 			if tt.expectedError {
 				assert.Error(t, err)
@@ -146,10 +162,10 @@ func TestLoadRedirects_PathCleaning(t *testing.T) {
 "/docs" = "https://docs.example.com"
 "no-slash" = "https://example.com/no-slash"`
 
-	expected := map[string]string{
-		"github":   "https://github.com/picotechllc/spray",
-		"docs":     "https://docs.example.com",
-		"no-slash": "https://example.com/no-slash",
+	expected := map[string]RedirectRule{
+		"github":   {To: "https://github.com/picotechllc/spray"},
+		"docs":     {To: "https://docs.example.com"},
+		"no-slash": {To: "https://example.com/no-slash"},
 	}
 
 	// Set a valid bucket name for the test
@@ -157,7 +173,7 @@ func TestLoadRedirects_PathCleaning(t *testing.T) {
 	defer os.Unsetenv("BUCKET_NAME")
 
 	store := &mockRedirectStore{content: content}
-	redirects, err := loadRedirects(context.Background(), store)
+	redirects, _, err := loadRedirects(context.Background(), store)
 
 	assert.NoError(t, err)
 	assert.Equal(t, expected, redirects)
@@ -170,7 +186,7 @@ func TestRedirectMetrics(t *testing.T) {
 	redirectConfigErrors.Reset()
 
 	// Test redirect hit metrics
-	redirectHits.WithLabelValues("test-bucket", "/test-path", "https://example.com").Inc()
+	redirectHits.WithLabelValues("test-bucket", "/test-path", "https://example.com", "302").Inc()
 	redirectLatency.WithLabelValues("test-bucket", "/test-path").Observe(0.1)
 
 	// Test config error metrics
@@ -181,3 +197,76 @@ func TestRedirectMetrics(t *testing.T) {
 	// Note: We can't directly test the values, but we can verify the metrics exist
 	// by checking that the test doesn't panic
 }
+
+func TestLoadRedirects_StatusCodes(t *testing.T) {
+	content := `[redirects]
+"/simple" = "https://example.com/simple"
+"/moved" = { to = "https://example.com/moved", status = 301 }
+"/api" = { to = "https://api.example.com/", status = 307 }
+
+[redirects."/permanent"]
+to = "https://example.com/permanent"
+status = 308
+`
+	redirects, _, err := loadRedirects(context.Background(), &mockRedirectStore{content: content})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]RedirectRule{
+		"simple":    {To: "https://example.com/simple"},
+		"moved":     {To: "https://example.com/moved", Status: 301},
+		"api":       {To: "https://api.example.com/", Status: 307},
+		"permanent": {To: "https://example.com/permanent", Status: 308},
+	}, redirects)
+
+	errorCases := map[string]string{
+		"unsupported status": `redirects = { "/a" = { to = "https://example.com", status = 200 } }`,
+		"status as string":   `redirects = { "/a" = { to = "https://example.com", status = "301" } }`,
+		"unknown field":      `redirects = { "/a" = { to = "https://example.com", code = 301 } }`,
+		"missing to":         `redirects = { "/a" = { status = 301 } }`,
+		"invalid value":      `redirects = { "/a" = 301 }`,
+	}
+	for name, content := range errorCases {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := loadRedirects(context.Background(), &mockRedirectStore{content: content})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestServeHTTP_RedirectStatusCodes(t *testing.T) {
+	const bucket = "redirect-status-bucket"
+	redirects := map[string]RedirectRule{
+		"found":     {To: "https://example.com/found"},
+		"moved":     {To: "https://example.com/moved", Status: http.StatusMovedPermanently},
+		"api/*":     {To: "https://api.example.com/:splat", Status: http.StatusTemporaryRedirect},
+		"permanent": {To: "https://example.com/permanent", Status: http.StatusPermanentRedirect},
+	}
+	server, err := newGCSServer(context.Background(), bucket, &mockLogger{}, &mockObjectStore{objects: map[string]mockObject{}}, redirects, nil, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{http.MethodGet, "/found", http.StatusFound, "https://example.com/found"},
+		{http.MethodGet, "/moved", http.StatusMovedPermanently, "https://example.com/moved"},
+		{http.MethodPost, "/api/v1/items", http.StatusTemporaryRedirect, "https://api.example.com/v1/items"},
+		{http.MethodGet, "/permanent", http.StatusPermanentRedirect, "https://example.com/permanent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			rr := httptest.NewRecorder()
+			server.ServeHTTP(rr, req)
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, tt.location, rr.Header().Get("Location"))
+		})
+	}
+
+	t.Run("metrics are labelled by status", func(t *testing.T) {
+		before := testutil.ToFloat64(redirectHits.WithLabelValues(bucket, "moved", "https://example.com/moved", "301"))
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/moved", nil))
+		assert.Equal(t, before+1, testutil.ToFloat64(redirectHits.WithLabelValues(bucket, "moved", "https://example.com/moved", "301")))
+	})
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/storage"
+)
+
+// configFiles are the .spray objects a site's configuration is loaded from
+var configFiles = []string{redirectsFile, rewritesFile, headersFile}
+
+// siteConfig is one consistent set of configuration loaded from a site's .spray directory
+type siteConfig struct {
+	redirects        map[string]RedirectRule
+	redirectPatterns []redirectPattern // pattern rules from redirects, in precedence order
+	rewriteRules     map[string]string // rewrites as configured, path -> object key
+	rewrites         []redirectPattern // compiled rewrites, in precedence order
+	headers          *HeaderConfig
+	store            ObjectStore       // store requests are served from, built for the object_cache settings
+	versions         map[string]string // config object key -> generation or ETag, "" when absent
+	warnings         []string          // problems in the configuration files that did not stop loading
+	loadedAt         time.Time
+}
+
+// newSiteConfig compiles the redirect and rewrite rules of a configuration
+func newSiteConfig(redirects map[string]RedirectRule, rewrites map[string]string, headers *HeaderConfig) (*siteConfig, error) {
+	redirectPatterns, err := compileRedirectPatterns(redirects)
+	if err != nil {
+		return nil, err
+	}
+	rewritePatterns, err := compileRewrites(rewrites)
+	if err != nil {
+		return nil, err
+	}
+
+	return &siteConfig{
+		redirects:        redirects,
+		redirectPatterns: redirectPatterns,
+		rewriteRules:     rewrites,
+		rewrites:         rewritePatterns,
+		headers:          headers,
+		loadedAt:         time.Now(),
+	}, nil
+}
+
+// loadSiteConfig reads and compiles the configuration in the store's .spray directory
+func loadSiteConfig(ctx context.Context, store ObjectStore) (*siteConfig, error) {
+	redirects, redirectWarnings, err := loadRedirects(ctx, store)
+	if err != nil {
+		return nil, fmt.Errorf("error loading redirects: %v", err)
+	}
+	rewrites, err := loadRewrites(ctx, store)
+	if err != nil {
+		return nil, fmt.Errorf("error loading rewrites: %v", err)
+	}
+	headers, headerWarnings, err := loadHeaders(ctx, store)
+	if err != nil {
+		return nil, fmt.Errorf("error loading headers: %v", err)
+	}
+
+	config, err := newSiteConfig(redirects, rewrites, headers)
+	if err != nil {
+		return nil, err
+	}
+	config.warnings = append(redirectWarnings, headerWarnings...)
+	return config, nil
+}
+
+// configVersions returns the generation of every configuration object, falling back to
+// the ETag or modification time for stores without generations. Missing and unreadable
+// objects have an empty version, matching the loaders that treat them as absent.
+func configVersions(ctx context.Context, store ObjectStore) (map[string]string, error) {
+	versions := make(map[string]string, len(configFiles))
+	for _, name := range configFiles {
+		key := filepath.Join(configDir, name)
+		attrs, err := store.GetObjectAttrs(ctx, key)
+		switch {
+		case err == storage.ErrObjectNotExist || (err != nil && isPermissionError(err)):
+			versions[key] = ""
+		case err != nil:
+			return nil, fmt.Errorf("error checking %s: %v", key, err)
+		case attrs.Generation != 0:
+			versions[key] = strconv.FormatInt(attrs.Generation, 10)
+		case attrs.Etag != "":
+			versions[key] = attrs.Etag
+		default:
+			versions[key] = fmt.Sprintf("%d-%d", attrs.Updated.UnixNano(), attrs.Size)
+		}
+	}
+	return versions, nil
+}
+
+// liveConfig holds the configuration of a server that can be reloaded while it runs
+type liveConfig struct {
+	store       ObjectStore       // uncached store the .spray files are read from
+	objectCache ObjectCacheConfig // server-level object cache settings
+	mu          sync.Mutex        // serialises reloads
+	current     atomic.Pointer[siteConfig]
+}
+
+// useSiteConfig sets the configuration fields of the server
+func (s *gcsServer) useSiteConfig(config *siteConfig) {
+	s.redirects = config.redirects
+	s.redirectPatterns = config.redirectPatterns
+	s.rewrites = config.rewrites
+	s.headers = config.headers
+	if config.store != nil {
+		s.store = config.store
+	}
+}
+
+// enableReload lets the configuration be reloaded from store, which should not be
+// cached so changes are seen immediately
+func (s *gcsServer) enableReload(store ObjectStore) {
+	live := &liveConfig{store: store}
+	config := s.site
+	if config == nil {
+		config = &siteConfig{
+			redirects:        s.redirects,
+			redirectPatterns: s.redirectPatterns,
+			rewrites:         s.rewrites,
+			headers:          s.headers,
+			loadedAt:         time.Now(),
+		}
+	}
+	config.store = s.store
+	live.current.Store(config)
+	s.live = live
+	configLastReload.WithLabelValues(s.bucketName).Set(float64(config.loadedAt.Unix()))
+}
+
+// snapshot returns the server with the configuration current at the time of the call,
+// so a request sees one consistent configuration even when a reload swaps it meanwhile
+func (s *gcsServer) snapshot() *gcsServer {
+	if s.live == nil {
+		return s
+	}
+	config := s.live.current.Load()
+	if config == s.site {
+		return s
+	}
+	copied := *s
+	copied.site = config
+	copied.useSiteConfig(config)
+	return &copied
+}
+
+// configWarnings returns the problems found loading the configuration in effect
+func (s *gcsServer) configWarnings() []string {
+	if s.site == nil {
+		return nil
+	}
+	return s.site.warnings
+}
+
+// reloadConfig loads the configuration again and swaps it in when it loads cleanly.
+// Unless force is set, nothing is loaded while the configuration objects are unchanged.
+// When loading fails the previous configuration stays active. It returns the
+// configuration replaced and the configuration in effect afterwards, which are the
+// same when nothing was swapped.
+func (s *gcsServer) reloadConfig(ctx context.Context, force bool) (*siteConfig, *siteConfig, error) {
+	if s.live == nil {
+		return nil, nil, fmt.Errorf("configuration reloading is not enabled")
+	}
+	s.live.mu.Lock()
+	defer s.live.mu.Unlock()
+	previous := s.live.current.Load()
+
+	versions, err := configVersions(ctx, s.live.store)
+	if err != nil {
+		return previous, previous, s.reloadFailed(err)
+	}
+	if !force && maps.Equal(versions, previous.versions) {
+		return previous, previous, nil
+	}
+
+	next, err := loadSiteConfig(ctx, s.live.store)
+	if err != nil {
+		return previous, previous, s.reloadFailed(err)
+	}
+	next.versions = versions
+	next.store = previous.store
+	if cache := resolveObjectCacheConfig(s.live.objectCache, next.headers); cache != resolveObjectCacheConfig(s.live.objectCache, previous.headers) {
+		// The object_cache settings changed; serve from a store built for them, which starts empty
+		next.store = servingStore(&config{bucketName: s.bucketName, store: s.live.store, objectCache: s.live.objectCache, headers: next.headers})
+	}
+	s.live.current.Store(next)
+
+	configReloads.WithLabelValues(s.bucketName, "success").Inc()
+	configLastReload.WithLabelValues(s.bucketName).Set(float64(next.loadedAt.Unix()))
+	s.logInfo("config_reload", configDir, map[string]any{
+		"redirect_count": len(next.redirects),
+		"rewrite_count":  len(next.rewriteRules),
+		"versions":       versions,
+		"warnings":       next.warnings,
+	})
+	return previous, next, nil
+}
+
+// reloadFailed records a failed reload; the previous configuration stays in effect
+func (s *gcsServer) reloadFailed(err error) error {
+	configReloads.WithLabelValues(s.bucketName, "failure").Inc()
+	s.logError(logging.Error, "config_reload", configDir, 0, err)
+	return err
+}
+
+// recordConfigVersions records the versions of the configuration objects as those of the
+// configuration in effect, which was loaded without them at startup. They are the baseline
+// for polling and are reported by the configuration endpoints.
+func (s *gcsServer) recordConfigVersions(ctx context.Context) {
+	s.live.mu.Lock()
+	defer s.live.mu.Unlock()
+	if versions, err := configVersions(ctx, s.live.store); err == nil {
+		config := *s.live.current.Load()
+		config.versions = versions
+		s.live.current.Store(&config)
+	}
+}
+
+// watchConfig polls the configuration objects every interval and reloads them when
+// their generation changes, until ctx is cancelled
+func (s *gcsServer) watchConfig(ctx context.Context, interval time.Duration) {
+	if s.live.current.Load().versions == nil {
+		s.recordConfigVersions(ctx)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Failures are counted and logged; the next tick tries again
+			s.reloadConfig(ctx, false)
+		}
+	}
+}
+
+// startConfigReload enables reloading the server's configuration from store and, when
+// interval is positive, polls for changes in the background until ctx is cancelled.
+// objectCache holds the server-level cache settings reloaded object_cache tables apply to.
+func (s *gcsServer) startConfigReload(ctx context.Context, store ObjectStore, objectCache ObjectCacheConfig, interval time.Duration) {
+	s.enableReload(store)
+	s.live.objectCache = objectCache
+	s.recordConfigVersions(ctx)
+	if interval > 0 {
+		go s.watchConfig(ctx, interval)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newReloadableServer serves a temporary directory with reloading enabled
+func newReloadableServer(t *testing.T, bucket string, files map[string]string) (*gcsServer, string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		writeTestFile(t, root, name, content)
+	}
+	store, err := newFileObjectStore(root)
+	require.NoError(t, err)
+
+	site, err := loadSiteConfig(context.Background(), store)
+	require.NoError(t, err)
+	server, err := newGCSServer(context.Background(), bucket, &mockLogger{}, store, site.redirects, site.rewriteRules, site.headers)
+	require.NoError(t, err)
+	server.site.warnings = site.warnings
+	server.enableReload(store)
+	return server, root
+}
+
+// redirectLocation requests path and returns the Location header, or "" when not redirected
+func redirectLocation(server *gcsServer, path string) string {
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+	return rr.Header().Get("Location")
+}
+
+func TestConfigVersions(t *testing.T) {
+	store := &mockStorageClient{objects: map[string]mockObject{
+		".spray/redirects.toml": {data: []byte("[redirects]")},
+	}}
+	versions, err := configVersions(context.Background(), store)
+	require.NoError(t, err)
+	assert.Len(t, versions, 3)
+	assert.Equal(t, "", versions[".spray/headers.toml"])
+	assert.NotEqual(t, "", versions[".spray/redirects.toml"])
+
+	versions, err = configVersions(context.Background(), &mockNotFoundStore{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{".spray/redirects.toml": "", ".spray/rewrites.toml": "", ".spray/headers.toml": ""}, versions)
+
+	_, err = configVersions(context.Background(), &errorObjectStore{})
+	assert.Error(t, err)
+
+	versions, err = configVersions(context.Background(), &mockPermissionErrorStore{})
+	require.NoError(t, err, "unreadable configuration is treated as absent")
+	assert.Equal(t, "", versions[".spray/redirects.toml"])
+}
+
+func TestConfigVersions_PrefersGeneration(t *testing.T) {
+	store := &versionedObjectStore{objects: map[string]versionedObject{
+		".spray/headers.toml": {data: "[powered_by]", generation: 42},
+	}}
+	versions, err := configVersions(context.Background(), store)
+	require.NoError(t, err)
+	assert.Equal(t, "42", versions[".spray/headers.toml"])
+}
+
+func TestReloadConfig(t *testing.T) {
+	const bucket = "reload-bucket"
+	server, root := newReloadableServer(t, bucket, map[string]string{
+		".spray/redirects.toml": "[redirects]\n\"/old\" = \"/new\"\n",
+	})
+	assert.Equal(t, "/new", redirectLocation(server, "/old"))
+
+	t.Run("changed files are swapped in", func(t *testing.T) {
+		before := testutil.ToFloat64(configReloads.WithLabelValues(bucket, "success"))
+		writeTestFile(t, root, ".spray/redirects.toml", "[redirects]\n\"/old\" = \"/newer\"\n\"/blog/*\" = \"/posts/:splat\"\n")
+
+		previous, config, err := server.reloadConfig(context.Background(), false)
+		require.NoError(t, err)
+		assert.NotSame(t, previous, config)
+		assert.Len(t, config.redirects, 2)
+		assert.Equal(t, "/newer", redirectLocation(server, "/old"))
+		assert.Equal(t, "/posts/a", redirectLocation(server, "/blog/a"), "patterns are recompiled")
+		assert.Equal(t, before+1, testutil.ToFloat64(configReloads.WithLabelValues(bucket, "success")))
+		assert.Equal(t, float64(config.loadedAt.Unix()), testutil.ToFloat64(configLastReload.WithLabelValues(bucket)))
+	})
+
+	t.Run("unchanged files are not reloaded", func(t *testing.T) {
+		previous, config, err := server.reloadConfig(context.Background(), false)
+		require.NoError(t, err)
+		assert.Same(t, previous, config)
+	})
+
+	t.Run("broken files keep the previous configuration", func(t *testing.T) {
+		before := testutil.ToFloat64(configReloads.WithLabelValues(bucket, "failure"))
+		writeTestFile(t, root, ".spray/redirects.toml", "[redirects\nbroken")
+
+		previous, config, err := server.reloadConfig(context.Background(), false)
+		assert.Error(t, err)
+		assert.Same(t, previous, config)
+		assert.Len(t, config.redirects, 2)
+		assert.Equal(t, "/newer", redirectLocation(server, "/old"))
+		assert.Equal(t, before+1, testutil.ToFloat64(configReloads.WithLabelValues(bucket, "failure")))
+	})
+
+	t.Run("headers are swapped too", func(t *testing.T) {
+		writeTestFile(t, root, ".spray/redirects.toml", "")
+		writeTestFile(t, root, ".spray/headers.toml", "[spa]\nenabled = true\n")
+		writeTestFile(t, root, "index.html", "shell")
+
+		previous, config, err := server.reloadConfig(context.Background(), true)
+		require.NoError(t, err)
+		assert.NotSame(t, previous, config)
+
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/deep/link", nil))
+		assert.Equal(t, "shell", rr.Body.String())
+	})
+}
+
+func TestReloadConfig_NotEnabled(t *testing.T) {
+	server := createMockServer(t, map[string]mockObject{}, map[string]RedirectRule{})
+	_, _, err := server.reloadConfig(context.Background(), true)
+	assert.Error(t, err)
+}
+
+func TestReloadConfig_ObjectCache(t *testing.T) {
+	server, root := newReloadableServer(t, "reload-cache-bucket", map[string]string{})
+	server.live.objectCache = ObjectCacheConfig{AllowSites: true}
+	initial := server.snapshot().store
+
+	writeTestFile(t, root, ".spray/headers.toml", "[object_cache]\nenabled = true\nmax_bytes = 1024\n")
+	_, _, err := server.reloadConfig(context.Background(), false)
+	require.NoError(t, err)
+	cached, ok := server.snapshot().store.(*cachingObjectStore)
+	require.True(t, ok, "enabling the cache takes effect on reload")
+	assert.Equal(t, int64(1024), cached.config.MaxBytes)
+
+	writeTestFile(t, root, ".spray/headers.toml", "[object_cache]\nenabled = true\nmax_bytes = 1024\n[spa]\nenabled = true\n")
+	_, _, err = server.reloadConfig(context.Background(), false)
+	require.NoError(t, err)
+	assert.Same(t, cached, server.snapshot().store, "the cache is kept while its settings are unchanged")
+
+	writeTestFile(t, root, ".spray/headers.toml", "")
+	_, _, err = server.reloadConfig(context.Background(), false)
+	require.NoError(t, err)
+	assert.NotEqual(t, initial, server.snapshot().store)
+	_, ok = server.snapshot().store.(*cachingObjectStore)
+	assert.False(t, ok, "disabling the cache takes effect on reload")
+}
+
+func TestWatchConfig(t *testing.T) {
+	server, root := newReloadableServer(t, "watch-bucket", map[string]string{
+		".spray/redirects.toml": "[redirects]\n\"/old\" = \"/new\"\n",
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.watchConfig(ctx, 10*time.Millisecond)
+
+	// Wait for the baseline so the edit below is seen as a change
+	require.Eventually(t, func() bool { return server.live.current.Load().versions != nil }, time.Second, 5*time.Millisecond)
+	writeTestFile(t, root, ".spray/redirects.toml", "[redirects]\n\"/old\" = \"/polled\"\n")
+
+	assert.Eventually(t, func() bool { return redirectLocation(server, "/old") == "/polled" }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestConfigRedirectsHandler_FollowsReload(t *testing.T) {
+	server, root := newReloadableServer(t, "reload-endpoint-bucket", map[string]string{})
+	writeTestFile(t, root, ".spray/redirects.toml", "[redirects]\n\"/a\" = \"/b\"\n")
+	_, _, err := server.reloadConfig(context.Background(), false)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	configRedirectsHandler(server)(rr, httptest.NewRequest(http.MethodGet, "/config/redirects", nil))
+	assert.Contains(t, rr.Body.String(), `"a":"/b"`)
+}
+
+func TestLoadConfig_ReloadInterval(t *testing.T) {
+	t.Setenv("BUCKET_NAME", "test-bucket")
+	t.Setenv("GOOGLE_PROJECT_ID", "test-project")
+	t.Setenv("SPRAY_CONFIG_RELOAD_INTERVAL", "45s")
+	cfg, err := loadConfig(context.Background(), &config{port: "8080"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 45*time.Second, cfg.reloadInterval)
+
+	cfg, err = loadConfig(context.Background(), &config{port: "8080", reloadInterval: time.Minute}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, cfg.reloadInterval, "the flag wins over the environment")
+
+	t.Setenv("SPRAY_CONFIG_RELOAD_INTERVAL", "often")
+	_, err = loadConfig(context.Background(), &config{port: "8080"}, nil)
+	assert.Error(t, err)
+}
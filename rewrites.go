@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/BurntSushi/toml"
+)
+
+// RewriteConfig represents the structure of the rewrites.toml file
+type RewriteConfig struct {
+	Rewrites map[string]string `toml:"rewrites"` // request path or pattern -> object key
+}
+
+// loadRewrites loads internal rewrites from a rewrites.toml file in the .spray directory.
+// Paths use the same syntax as redirects; targets are object keys that may use the
+// placeholders captured by the path.
+func loadRewrites(ctx context.Context, store ObjectStore) (map[string]string, error) {
+	configPath := filepath.Join(configDir, rewritesFile)
+	reader, _, err := store.GetObject(ctx, configPath)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			// No rewrites file is fine, return empty map
+			return make(map[string]string), nil
+		}
+		// Handle permission errors gracefully - rewrites are optional
+		if isPermissionError(err) {
+			redirectConfigErrors.WithLabelValues("", "permission_denied").Inc()
+			logStructuredWarning("load_rewrites", configPath, err)
+			return make(map[string]string), nil
+		}
+		redirectConfigErrors.WithLabelValues("", "read_error").Inc()
+		return nil, fmt.Errorf("error reading rewrites file at %s: %v", configPath, err)
+	}
+	defer reader.Close()
+
+	var rewriteConfig RewriteConfig
+	if _, err := toml.NewDecoder(reader).Decode(&rewriteConfig); err != nil {
+		redirectConfigErrors.WithLabelValues("", "parse_error").Inc()
+		return nil, fmt.Errorf("error parsing rewrites file at %s: %v", configPath, err)
+	}
+
+	// Clean and validate rewrites
+	rewrites := make(map[string]string)
+	for path, target := range rewriteConfig.Rewrites {
+		if errType, err := validateRewriteRule(path, target); err != nil {
+			redirectConfigErrors.WithLabelValues("", errType).Inc()
+			return nil, err
+		}
+		rewrites[cleanRedirectPath(path)] = strings.TrimPrefix(target, "/")
+	}
+
+	return rewrites, nil
+}
+
+// validateRewriteRule checks a rewrite as written in rewrites.toml. It returns the
+// error type counted in redirectConfigErrors along with the error.
+func validateRewriteRule(path, target string) (string, error) {
+	cleanedTarget := strings.TrimPrefix(target, "/")
+	if cleanedTarget == "" || strings.Contains(cleanedTarget, "..") {
+		return "invalid_target", fmt.Errorf("invalid rewrite target %q for path %q", target, path)
+	}
+	if _, err := compileRedirectPattern(cleanRedirectPath(path), RedirectRule{To: cleanedTarget}); err != nil {
+		return "invalid_pattern", err
+	}
+	return "", nil
+}
+
+// compileRewrites compiles every rewrite, exact paths included, in redirect precedence order
+func compileRewrites(rewrites map[string]string) ([]redirectPattern, error) {
+	patterns := make([]redirectPattern, 0, len(rewrites))
+	for path, target := range rewrites {
+		pattern, err := compileRedirectPattern(path, RedirectRule{To: target})
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite: %v", err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	sortRedirectPatterns(patterns)
+	return patterns, nil
+}
+
+// findRewrite returns the rewrite rule matching a request and the object key it maps to
+func (s *gcsServer) findRewrite(r *http.Request, cleanPath string) (string, string, bool) {
+	if len(s.rewrites) == 0 {
+		return "", "", false
+	}
+
+	matchPath := redirectMatchPath(r.URL.Path, cleanPath)
+	query := r.URL.Query()
+	for _, pattern := range s.rewrites {
+		params, ok := pattern.match(matchPath, query)
+		if !ok {
+			continue
+		}
+		target, ok := rewriteObjectKey(expandRedirectDestination(pattern.rule.To, params))
+		if !ok {
+			return "", "", false
+		}
+		return pattern.path, target, true
+	}
+	return "", "", false
+}
+
+// rewriteObjectKey turns an expanded rewrite target into an object key. The captured
+// values are already decoded, so unlike cleanRequestPath it does not unescape again.
+// Directories map to their index.html, and targets that could escape the bucket are refused.
+func rewriteObjectKey(target string) (string, bool) {
+	if strings.Contains(target, "..") {
+		return "", false
+	}
+	key := strings.TrimPrefix(path.Clean("/"+target), "/")
+	if key == "" {
+		return "index.html", true
+	}
+	if strings.HasSuffix(target, "/") {
+		key += "/index.html"
+	}
+	return key, true
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rewriteStore serves a rewrites.toml file from a mockObjectStore
+func rewriteStore(content string) *mockObjectStore {
+	return &mockObjectStore{objects: map[string]mockObject{
+		".spray/rewrites.toml": {data: []byte(content), contentType: "application/toml"},
+	}}
+}
+
+func TestLoadRewrites(t *testing.T) {
+	rewrites, err := loadRewrites(context.Background(), rewriteStore(`[rewrites]
+"/app/*" = "app/index.html"
+"/v2/docs/*" = "/docs-v2/:splat"
+"/about" = "pages/about.html"
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"app/*":     "app/index.html",
+		"v2/docs/*": "docs-v2/:splat",
+		"about":     "pages/about.html",
+	}, rewrites)
+
+	rewrites, err = loadRewrites(context.Background(), &mockObjectStore{objects: map[string]mockObject{}})
+	require.NoError(t, err)
+	assert.Empty(t, rewrites)
+
+	errorCases := map[string]string{
+		"invalid toml":     "[rewrites\n",
+		"empty target":     "[rewrites]\n\"/a\" = \"\"\n",
+		"traversal target": "[rewrites]\n\"/a\" = \"../secret\"\n",
+		"invalid pattern":  "[rewrites]\n\"/a/*/b\" = \"x\"\n",
+	}
+	for name, content := range errorCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadRewrites(context.Background(), rewriteStore(content))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestServeHTTP_Rewrites(t *testing.T) {
+	const bucket = "rewrites-bucket"
+	store := &mockObjectStore{objects: map[string]mockObject{
+		"app/index.html":           {data: []byte("app shell"), contentType: "text/html"},
+		"docs-v2/guide/intro.md":   {data: []byte("v2 intro"), contentType: "text/markdown"},
+		"docs-v2/guide/index.html": {data: []byte("v2 guide"), contentType: "text/html"},
+		"pages/about.html":         {data: []byte("about"), contentType: "text/html"},
+		"docs-v2/a%20b.html":       {data: []byte("percent"), contentType: "text/html"},
+		"docs-v2/a b.html":         {data: []byte("space"), contentType: "text/html"},
+	}}
+	rewrites := map[string]string{
+		"app/*":     "app/index.html",
+		"v2/docs/*": "docs-v2/:splat",
+		"about":     "pages/about.html",
+		"old":       "pages/about.html",
+		"missing":   "pages/missing.html",
+	}
+	redirects := map[string]RedirectRule{
+		"old": {To: "https://example.com/about"},
+	}
+	server, err := newGCSServer(context.Background(), bucket, &mockLogger{}, store, redirects, rewrites, getDefaultHeaderConfig())
+	require.NoError(t, err)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	tests := []struct {
+		path        string
+		body        string
+		contentType string
+	}{
+		{"/app/dashboard/settings", "app shell", "text/html"},
+		{"/app", "app shell", "text/html"},
+		{"/v2/docs/guide/intro.md", "v2 intro", "text/markdown"},
+		{"/v2/docs/guide/", "v2 guide", "text/html"},
+		{"/about", "about", "text/html"},
+		{"/v2/docs/a%2520b.html", "percent", "text/html"},
+		{"/v2/docs/a%20b.html", "space", "text/html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := serve(tt.path)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.body, rr.Body.String())
+			assert.Equal(t, tt.contentType, rr.Header().Get("Content-Type"))
+			assert.Empty(t, rr.Header().Get("Location"))
+		})
+	}
+
+	t.Run("redirects take precedence", func(t *testing.T) {
+		rr := serve("/old")
+		assert.Equal(t, http.StatusFound, rr.Code)
+		assert.Equal(t, "https://example.com/about", rr.Header().Get("Location"))
+	})
+
+	t.Run("missing target", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve("/missing").Code)
+	})
+
+	t.Run("unmatched paths are served as is", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve("/v3/docs/guide/intro.md").Code)
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		before := testutil.ToFloat64(rewritesTotal.WithLabelValues(bucket, "app/*"))
+		serve("/app/a")
+		serve("/app/b")
+		assert.Equal(t, before+2, testutil.ToFloat64(rewritesTotal.WithLabelValues(bucket, "app/*")))
+	})
+}
+
+func TestNewGCSServer_InvalidRewrite(t *testing.T) {
+	_, err := newGCSServer(context.Background(), "test-bucket", &mockLogger{}, &mockObjectStore{}, nil, map[string]string{"a/*/b": "x"}, nil)
+	assert.Error(t, err)
+}
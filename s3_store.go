@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+const (
+	s3DefaultRegion  = "us-east-1"
+	s3SigningService = "s3"
+	// emptyPayloadHash is the SHA-256 of an empty request body
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// s3Options configures an S3ObjectStore
+type s3Options struct {
+	endpoint        string // e.g. https://s3.us-east-1.amazonaws.com or http://localhost:9000
+	region          string
+	pathStyle       bool // address buckets as endpoint/bucket instead of bucket.endpoint
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	httpClient      *http.Client
+}
+
+// s3OptionsFromEnv reads S3 settings from the environment.
+// S3_ENDPOINT selects S3-compatible services such as MinIO or R2; custom
+// endpoints default to path-style addressing unless S3_FORCE_PATH_STYLE=false.
+func s3OptionsFromEnv() s3Options {
+	opts := s3Options{
+		endpoint:        os.Getenv("S3_ENDPOINT"),
+		region:          os.Getenv("AWS_REGION"),
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if opts.region == "" {
+		opts.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if opts.region == "" {
+		opts.region = s3DefaultRegion
+	}
+
+	opts.pathStyle = opts.endpoint != ""
+	if v := os.Getenv("S3_FORCE_PATH_STYLE"); v != "" {
+		opts.pathStyle = v == "true"
+	}
+	return opts
+}
+
+// S3ObjectStore implements ObjectStore using the S3 REST API (AWS S3, MinIO, Cloudflare R2)
+type S3ObjectStore struct {
+	bucket   string
+	endpoint *url.URL
+	opts     s3Options
+	client   *http.Client
+	now      func() time.Time
+}
+
+// newS3ObjectStore creates an S3ObjectStore for the given bucket
+func newS3ObjectStore(bucket string, opts s3Options) (*S3ObjectStore, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("S3 bucket name is required")
+	}
+	if opts.region == "" {
+		opts.region = s3DefaultRegion
+	}
+
+	rawEndpoint := opts.endpoint
+	if rawEndpoint == "" {
+		rawEndpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", opts.region)
+	}
+	endpoint, err := url.Parse(rawEndpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", rawEndpoint)
+	}
+
+	client := opts.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &S3ObjectStore{
+		bucket:   bucket,
+		endpoint: endpoint,
+		opts:     opts,
+		client:   client,
+		now:      time.Now,
+	}, nil
+}
+
+// GetObject retrieves an object from the S3 bucket
+func (s *S3ObjectStore) GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	resp, err := s.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, nil, s3ResponseError(http.MethodGet, path, resp)
+	}
+
+	return resp.Body, s3ObjectAttrs(path, resp), nil
+}
+
+// GetObjectAttrs retrieves object metadata with a HEAD request
+func (s *S3ObjectStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	resp, err := s.do(ctx, http.MethodHead, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3ResponseError(http.MethodHead, path, resp)
+	}
+	return s3ObjectAttrs(path, resp), nil
+}
+
+// GetObjectRange retrieves a byte range of an object using an HTTP Range request
+func (s *S3ObjectStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	rangeSpec := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		rangeSpec = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, path, http.Header{"Range": {rangeSpec}})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		attrs := s3ObjectAttrs(path, resp)
+		// Content-Length covers only the range; the object size is in Content-Range
+		if _, total, found := strings.Cut(resp.Header.Get("Content-Range"), "/"); found {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				attrs.Size = size
+			}
+		}
+		return resp.Body, attrs, nil
+	case http.StatusOK:
+		// The server ignored the Range header and sent the whole object
+		attrs := s3ObjectAttrs(path, resp)
+		limited, err := limitObjectReader(resp.Body, offset, length)
+		if err != nil {
+			return nil, nil, err
+		}
+		return limited, attrs, nil
+	default:
+		defer resp.Body.Close()
+		return nil, nil, s3ResponseError(http.MethodGet, path, resp)
+	}
+}
+
+// s3ListBucketResult is the XML document returned by ListObjectsV2
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key          string `xml:"Key"`
+		LastModified string `xml:"LastModified"`
+		ETag         string `xml:"ETag"`
+		Size         int64  `xml:"Size"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// ListObjects lists one level of the bucket below prefix with ListObjectsV2
+func (s *S3ObjectStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+		"delimiter": {"/"},
+	}
+	if limit > 0 {
+		query.Set("max-keys", strconv.Itoa(limit))
+	}
+	if pageToken != "" {
+		query.Set("continuation-token", pageToken)
+	}
+	u := s.objectURL("")
+	// Signing encodes the query the same way, so the signature matches what is sent
+	u.RawQuery = s3CanonicalQuery(query)
+
+	target := "list " + prefix
+	resp, err := s.send(ctx, http.MethodGet, u, target, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", s3ResponseError(http.MethodGet, target, resp)
+	}
+
+	var result s3ListBucketResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, "", fmt.Errorf("s3 GET %s: invalid listing: %v", target, err)
+	}
+
+	var entries []*storage.ObjectAttrs
+	for _, object := range result.Contents {
+		// Folder placeholder objects are named after the prefix itself
+		if object.Key == prefix {
+			continue
+		}
+		attrs := &storage.ObjectAttrs{
+			Name: object.Key,
+			Size: object.Size,
+			Etag: strings.Trim(object.ETag, `"`),
+		}
+		if modified, err := time.Parse(time.RFC3339, object.LastModified); err == nil {
+			attrs.Updated = modified
+		}
+		entries = append(entries, attrs)
+	}
+	for _, common := range result.CommonPrefixes {
+		entries = append(entries, &storage.ObjectAttrs{Prefix: common.Prefix})
+	}
+	sort.Slice(entries, func(i, j int) bool { return listEntryKey(entries[i]) < listEntryKey(entries[j]) })
+
+	if !result.IsTruncated {
+		return entries, "", nil
+	}
+	return entries, result.NextContinuationToken, nil
+}
+
+// objectURL returns the request URL for an object key
+func (s *S3ObjectStore) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	escapedKey := s3EscapePath(key)
+	if s.opts.pathStyle {
+		u.Path = "/" + s.bucket + "/" + key
+		u.RawPath = "/" + s3EscapePath(s.bucket) + "/" + escapedKey
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + escapedKey
+	}
+	return &u
+}
+
+// do issues a signed request for an object key
+func (s *S3ObjectStore) do(ctx context.Context, method, key string, header http.Header) (*http.Response, error) {
+	return s.send(ctx, method, s.objectURL(key), key, header)
+}
+
+// send issues a signed request; target names the object or listing in errors
+func (s *S3ObjectStore) send(ctx context.Context, method string, u *url.URL, target string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, values := range header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+
+	// Anonymous requests are allowed for public buckets
+	if s.opts.accessKeyID != "" {
+		signS3Request(req, s.opts, s.now())
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: connection error: %v", method, target, err)
+	}
+	return resp, nil
+}
+
+// s3ObjectAttrs maps S3 response headers onto the storage attributes spray uses
+func s3ObjectAttrs(key string, resp *http.Response) *storage.ObjectAttrs {
+	attrs := &storage.ObjectAttrs{
+		Name:            key,
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
+		CacheControl:    resp.Header.Get("Cache-Control"),
+		Etag:            strings.Trim(resp.Header.Get("ETag"), `"`),
+		Size:            resp.ContentLength,
+	}
+	if attrs.ContentType == "" {
+		attrs.ContentType = "application/octet-stream"
+	}
+	if attrs.Size < 0 {
+		attrs.Size = 0
+	}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		attrs.Updated = lastModified
+	}
+	return attrs
+}
+
+// s3ErrorBody is the XML error document returned by S3
+type s3ErrorBody struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3ResponseError converts a non-success S3 response into an error.
+// Missing objects map to storage.ErrObjectNotExist so callers can treat all backends alike.
+func s3ResponseError(method, key string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return storage.ErrObjectNotExist
+	}
+
+	var body s3ErrorBody
+	if resp.Body != nil {
+		// HEAD responses and some proxies return no body; the status code is enough then
+		_ = xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body)
+	}
+	if body.Code == "" {
+		body.Code = http.StatusText(resp.StatusCode)
+	}
+
+	// The status code stays in the message so isPermissionError recognises 401/403
+	return fmt.Errorf("s3 %s %s: %d %s: %s", method, key, resp.StatusCode, body.Code, body.Message)
+}
+
+// signS3Request adds AWS Signature Version 4 headers to the request.
+// All headers present on the request are signed, along with the host.
+func signS3Request(req *http.Request, opts s3Options, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	shortDate := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if opts.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", opts.sessionToken)
+	}
+
+	// Canonical headers: lowercase names, sorted, with trimmed values
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{shortDate, opts.region, s3SigningService, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSHA256(canonicalRequest),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+opts.secretAccessKey), shortDate)
+	signingKey = hmacSHA256(signingKey, opts.region)
+	signingKey = hmacSHA256(signingKey, s3SigningService)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		opts.accessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+// s3CanonicalQuery encodes query parameters sorted by key as SigV4 requires
+func s3CanonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), values[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, s3EscapeQuery(k)+"="+s3EscapeQuery(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3EscapePath URI-encodes an object key, leaving path separators intact
+func s3EscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = s3EscapeQuery(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3EscapeQuery URI-encodes everything except the SigV4 unreserved characters
+func s3EscapeQuery(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
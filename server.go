@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -21,6 +23,7 @@ import (
 	"cloud.google.com/go/logging"
 	"cloud.google.com/go/storage"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/api/iterator"
 )
 
 // GCSObjectStore implements ObjectStore using Google Cloud Storage
@@ -71,27 +74,100 @@ func (s *GCSObjectStore) GetObject(ctx context.Context, path string) (io.ReadClo
 	return reader, attrs, nil
 }
 
+// GetObjectRange reads a byte range of an object from the GCS bucket using a ranged read.
+// A negative length reads until the end of the object.
+func (s *GCSObjectStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	reader, err := s.bucket.Object(path).NewRangeReader(ctx, offset, length)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, readerObjectAttrs(path, reader.Attrs), nil
+}
+
+// GetObjectAttrs retrieves object metadata without downloading the object body
+func (s *GCSObjectStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	obj := s.bucket.Object(path)
+	attrs, err := obj.Attrs(ctx)
+	if err == nil || !isPermissionError(err) {
+		return attrs, err
+	}
+
+	// Unauthenticated clients cannot read metadata of public objects through the
+	// JSON API, but a zero-length ranged read is sent as a HEAD request instead
+	reader, err := obj.NewRangeReader(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return readerObjectAttrs(path, reader.Attrs), nil
+}
+
+// ListObjects lists one level of the bucket below prefix using a delimiter query
+func (s *GCSObjectStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	it := s.bucket.Objects(ctx, &storage.Query{Prefix: prefix, Delimiter: "/"})
+	var page []*storage.ObjectAttrs
+	next, err := iterator.NewPager(it, limit, pageToken).NextPage(&page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Folder placeholder objects are named after the prefix itself
+	entries := page[:0]
+	for _, attrs := range page {
+		if attrs.Name != prefix || attrs.Prefix != "" {
+			entries = append(entries, attrs)
+		}
+	}
+	return entries, next, nil
+}
+
+// readerObjectAttrs builds object attributes from the metadata returned with a reader,
+// which avoids a separate Attrs round trip
+func readerObjectAttrs(path string, ra storage.ReaderObjectAttrs) *storage.ObjectAttrs {
+	return &storage.ObjectAttrs{
+		Name:            path,
+		ContentType:     ra.ContentType,
+		ContentEncoding: ra.ContentEncoding,
+		CacheControl:    ra.CacheControl,
+		Size:            ra.Size,
+		Updated:         ra.LastModified,
+		Generation:      ra.Generation,
+		Metageneration:  ra.Metageneration,
+		CRC32C:          ra.CRC32C,
+	}
+}
+
 type gcsServer struct {
-	store      ObjectStore
-	bucketName string
-	logger     Logger
-	redirects  map[string]string
-	headers    *HeaderConfig
+	store            ObjectStore
+	bucketName       string
+	logger           Logger
+	redirects        map[string]RedirectRule
+	redirectPatterns []redirectPattern // pattern rules from redirects, in precedence order
+	rewrites         []redirectPattern // internal rewrites, in precedence order
+	headers          *HeaderConfig
+	site             *siteConfig // the configuration the fields above were taken from
+	live             *liveConfig // set when the configuration can be reloaded
 }
 
 // newGCSServer creates a new GCS server
-func newGCSServer(ctx context.Context, bucketName string, logger Logger, store ObjectStore, redirects map[string]string, headers *HeaderConfig) (*gcsServer, error) {
+func newGCSServer(ctx context.Context, bucketName string, logger Logger, store ObjectStore, redirects map[string]RedirectRule, rewrites map[string]string, headers *HeaderConfig) (*gcsServer, error) {
 	if store == nil {
 		return nil, fmt.Errorf("store cannot be nil")
 	}
 
-	return &gcsServer{
+	site, err := newSiteConfig(redirects, rewrites, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &gcsServer{
 		store:      store,
 		bucketName: bucketName,
 		logger:     logger,
-		redirects:  redirects,
-		headers:    headers,
-	}, nil
+		site:       site,
+	}
+	server.useSiteConfig(site)
+	return server, nil
 }
 
 // cleanRequestPath normalizes and validates the request path.
@@ -233,6 +309,10 @@ func getErrorType(err error) string {
 	switch {
 	case err == storage.ErrObjectNotExist:
 		return "object_not_found"
+	case err == errUnsatisfiableRange:
+		return "range_not_satisfiable"
+	case errors.Is(err, errHiddenPath):
+		return "hidden_path"
 	case isPermissionError(err):
 		return "permission_denied"
 	case strings.Contains(errStr, "timeout"):
@@ -244,8 +324,27 @@ func getErrorType(err error) string {
 	}
 }
 
+// prefersHTML determines the response format based on the Accept header: browsers get
+// HTML, API clients and requests without a preference get JSON
+func prefersHTML(r *http.Request) bool {
+	acceptHeader := r.Header.Get("Accept")
+	wantsJSON := strings.Contains(acceptHeader, "application/json") ||
+		strings.Contains(acceptHeader, "*/*") && !strings.Contains(acceptHeader, "text/html")
+	return strings.Contains(acceptHeader, "text/html") || (!wantsJSON && acceptHeader != "")
+}
+
+// objectHeaders are response headers that describe the requested object. They are
+// removed before an error body is written in its place.
+var objectHeaders = []string{"Content-Encoding", "Content-Length", "ETag", "Last-Modified", "Cache-Control"}
+
 // sendUserFriendlyError sends a user-friendly error response while logging the detailed error
 func (s *gcsServer) sendUserFriendlyError(w http.ResponseWriter, r *http.Request, path string, statusCode int, userMessage string, actualError error) {
+	// Encoding and validators may already be set for the object; the error body is
+	// neither encoded nor cacheable as that object
+	for _, name := range objectHeaders {
+		w.Header().Del(name)
+	}
+
 	// Log the detailed error for debugging
 	var severity logging.Severity
 	switch statusCode {
@@ -264,13 +363,13 @@ func (s *gcsServer) sendUserFriendlyError(w http.ResponseWriter, r *http.Request
 	errorTotal.WithLabelValues(s.bucketName, path, errorType).Inc()
 	requestsTotal.WithLabelValues(s.bucketName, path, r.Method, fmt.Sprintf("%d", statusCode)).Inc()
 
-	// Determine response format based on Accept header
-	acceptHeader := r.Header.Get("Accept")
-	wantsJSON := strings.Contains(acceptHeader, "application/json") ||
-		strings.Contains(acceptHeader, "*/*") && !strings.Contains(acceptHeader, "text/html")
-
 	// If the request explicitly accepts HTML or doesn't specify (browser behavior)
-	if strings.Contains(acceptHeader, "text/html") || (!wantsJSON && acceptHeader != "") {
+	if prefersHTML(r) {
+		// Prefer the site's own error page, e.g. 404.html, over the built-in one
+		if s.serveErrorPage(w, r, path, statusCode) {
+			return
+		}
+
 		// Send HTML error page for browsers
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.WriteHeader(statusCode)
@@ -381,9 +480,38 @@ func (s *gcsServer) sendUserFriendlyError(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// sendStorageError maps an ObjectStore error onto the matching user-facing error response
+func (s *gcsServer) sendStorageError(w http.ResponseWriter, r *http.Request, path string, err error) {
+	if err == storage.ErrObjectNotExist {
+		s.sendUserFriendlyError(
+			w, r, path, http.StatusNotFound,
+			"The requested resource was not found.",
+			err,
+		)
+		return
+	}
+
+	if isPermissionError(err) {
+		s.sendUserFriendlyError(
+			w, r, path, http.StatusInternalServerError,
+			"The service is temporarily unavailable due to a configuration issue. Please try again later.",
+			err,
+		)
+		return
+	}
+
+	// For any other storage error
+	s.sendUserFriendlyError(
+		w, r, path, http.StatusInternalServerError,
+		"The service is temporarily unavailable. Please try again later.",
+		err,
+	)
+}
+
 func (s *gcsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	ctx := r.Context()
+	s = s.snapshot()
 
 	// Track active requests
 	activeRequests.WithLabelValues(s.bucketName).Inc()
@@ -438,7 +566,8 @@ func (s *gcsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		requestDuration.WithLabelValues(s.bucketName, r.URL.Path, r.Method).Observe(duration.Seconds())
 	}()
 
-	cleanPath, err := cleanRequestPath(r.URL.Path)
+	// r.URL.Path is already decoded; decode the escaped form once so a literal % in an object key is kept
+	cleanPath, err := cleanRequestPath(r.URL.EscapedPath())
 	if err != nil {
 		s.sendUserFriendlyError(
 			wrapped, r, r.URL.Path, http.StatusBadRequest,
@@ -448,57 +577,175 @@ func (s *gcsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Configuration and hidden objects are never served, not even through redirects
+	if s.blockHiddenPath(wrapped, r, cleanPath) {
+		return
+	}
+
 	// Check for redirects
-	if destination, exists := s.redirects[cleanPath]; exists {
-		redirectStart := time.Now()
+	redirectStart := time.Now()
+	if rulePath, rule, exists := s.findRedirect(r, cleanPath); exists {
+		status := rule.statusCode()
+		location := rule.location(r.URL.RawQuery)
 		s.logInfo("redirect", cleanPath, map[string]any{
-			"destination": destination,
+			"destination": location,
+			"rule":        rulePath,
+			"status":      status,
 		})
-		requestsTotal.WithLabelValues(s.bucketName, cleanPath, r.Method, "302").Inc()
-		redirectHits.WithLabelValues(s.bucketName, cleanPath, destination).Inc()
-		redirectLatency.WithLabelValues(s.bucketName, cleanPath).Observe(time.Since(redirectStart).Seconds())
-		wrapped.statusCode = 302
-		http.Redirect(wrapped, r, destination, http.StatusFound)
+		requestsTotal.WithLabelValues(s.bucketName, cleanPath, r.Method, strconv.Itoa(status)).Inc()
+		// Label pattern hits by rule so splat matches do not create a series per URL
+		redirectHits.WithLabelValues(s.bucketName, rulePath, s.redirects[rulePath].To, strconv.Itoa(status)).Inc()
+		redirectLatency.WithLabelValues(s.bucketName, rulePath).Observe(time.Since(redirectStart).Seconds())
+		wrapped.statusCode = status
+		http.Redirect(wrapped, r, location, status)
 		return
 	}
 
-	// Track GCS operations timing
-	gcsStart := time.Now()
-	reader, attrs, err := s.store.GetObject(ctx, cleanPath)
-	gcsLatency.WithLabelValues(s.bucketName, "get_object").Observe(time.Since(gcsStart).Seconds())
+	// Serve rewritten paths from their target object without redirecting
+	rewritten := false
+	if rulePath, target, exists := s.findRewrite(r, cleanPath); exists {
+		s.logInfo("rewrite", cleanPath, map[string]any{
+			"target": target,
+			"rule":   rulePath,
+		})
+		rewritesTotal.WithLabelValues(s.bucketName, rulePath).Inc()
+		cleanPath = target
+		rewritten = true
+	}
+	if rewritten && s.blockHiddenPath(wrapped, r, cleanPath) {
+		return
+	}
 
-	if err != nil {
-		if err == storage.ErrObjectNotExist {
-			s.sendUserFriendlyError(
-				wrapped, r, cleanPath, http.StatusNotFound,
-				"The requested resource was not found.",
-				err,
-			)
+	// Fetch metadata first so that 304 and HEAD responses never open the object body
+	objectPath, attrs, canonical, err := s.resolveObject(ctx, r, cleanPath, rewritten)
+	// Clean URLs can resolve a visible path to a hidden object
+	if err == nil && s.blockHiddenPath(wrapped, r, objectPath) {
+		return
+	}
+	if canonical != "" {
+		s.logInfo("clean_url_redirect", cleanPath, map[string]any{
+			"destination": canonical,
+		})
+		requestsTotal.WithLabelValues(s.bucketName, cleanPath, r.Method, "301").Inc()
+		wrapped.statusCode = http.StatusMovedPermanently
+		http.Redirect(wrapped, r, canonical, http.StatusMovedPermanently)
+		return
+	}
+	if err == nil {
+		cleanPath = objectPath
+	}
+
+	// List directories without an index.html where autoindex is enabled
+	if err == storage.ErrObjectNotExist && !rewritten {
+		if dir, ok := s.autoindexDirectory(r, cleanPath); ok {
+			s.serveAutoindex(wrapped, r, cleanPath, dir, start)
 			return
 		}
+	}
 
-		if isPermissionError(err) {
-			s.sendUserFriendlyError(
-				wrapped, r, cleanPath, http.StatusInternalServerError,
-				"The service is temporarily unavailable due to a configuration issue. Please try again later.",
-				err,
-			)
-			return
+	// Serve the SPA fallback for client-side routes that have no object
+	if err == storage.ErrObjectNotExist {
+		if fallback, ok := s.spaFallback(r, cleanPath); ok {
+			s.logInfo("spa_fallback", cleanPath, map[string]any{
+				"fallback": fallback,
+			})
+			gcsStart := time.Now()
+			attrs, err = s.store.GetObjectAttrs(ctx, fallback)
+			gcsLatency.WithLabelValues(s.bucketName, "get_attrs").Observe(time.Since(gcsStart).Seconds())
+			if err == nil {
+				spaFallbacks.WithLabelValues(s.bucketName).Inc()
+			}
+			cleanPath = fallback
+			if s.blockHiddenPath(wrapped, r, cleanPath) {
+				return
+			}
 		}
+	}
 
-		// For any other storage error
-		s.sendUserFriendlyError(
-			wrapped, r, cleanPath, http.StatusInternalServerError,
-			"The service is temporarily unavailable. Please try again later.",
-			err,
-		)
+	if err != nil {
+		s.sendStorageError(wrapped, r, cleanPath, err)
 		return
 	}
-	defer reader.Close()
+
+	// Serve a precompressed variant when the client accepts one
+	objectPath, attrs = s.selectPrecompressedVariant(ctx, wrapped, r, cleanPath, attrs)
+	if objectPath != cleanPath && s.blockHiddenPath(wrapped, r, objectPath) {
+		return
+	}
+
+	// Otherwise compress compressible content on the fly when the client accepts gzip
+	attrs, compress := s.negotiateCompression(wrapped, r, attrs)
 
 	// Track object size
 	objectSize.WithLabelValues(s.bucketName, cleanPath).Observe(float64(attrs.Size))
 
+	// Set cache headers and answer conditional requests with 304 Not Modified
+	cachePolicy, notModified := s.applyCacheValidation(wrapped, r, cleanPath, attrs, start)
+	if notModified {
+		return
+	}
+
+	wrapped.Header().Set("Content-Type", attrs.ContentType)
+
+	// Advertise byte-range support when the object size is known
+	if attrs.Size > 0 {
+		wrapped.Header().Set("Accept-Ranges", "bytes")
+	}
+
+	if r.Method == http.MethodHead {
+		s.serveHead(wrapped, r, cleanPath, attrs, cachePolicy, !compress, start)
+		return
+	}
+
+	// Serve partial content for Range requests
+	if s.serveRangeRequest(wrapped, r, cleanPath, objectPath, attrs, start) {
+		return
+	}
+
+	// Only now is the body needed; a ranged read from offset zero skips a second metadata lookup
+	gcsStart := time.Now()
+	reader, _, err := s.store.GetObjectRange(ctx, objectPath, 0, -1)
+	gcsLatency.WithLabelValues(s.bucketName, "get_object").Observe(time.Since(gcsStart).Seconds())
+
+	if err != nil {
+		s.sendStorageError(wrapped, r, cleanPath, err)
+		return
+	}
+	defer reader.Close()
+
+	// Copy the object contents to the response while tracking bytes transferred
+	var written int64
+	if compress {
+		written, err = s.copyCompressed(wrapped, reader, attrs.ContentType)
+	} else {
+		written, err = io.Copy(wrapped, reader)
+	}
+	if err != nil {
+		// If we encounter an error during copy, the response might already be partially written
+		// We can't change the status code at this point, but we can log the error
+		wrapped.statusCode = 500
+		s.logError(logging.Error, "copy_contents", cleanPath, http.StatusInternalServerError, err)
+		errorTotal.WithLabelValues(s.bucketName, cleanPath, "copy_error").Inc()
+		requestsTotal.WithLabelValues(s.bucketName, cleanPath, r.Method, "500").Inc()
+	} else {
+		requestsTotal.WithLabelValues(s.bucketName, cleanPath, r.Method, "200").Inc()
+		bytesTransferred.WithLabelValues(s.bucketName, cleanPath, r.Method, "download").Add(float64(written))
+
+		// Log successful request
+		s.logInfo("serve_request", cleanPath, map[string]any{
+			"status":       200,
+			"bytes_served": written,
+			"content_type": attrs.ContentType,
+			"cache_policy": cachePolicy,
+			"duration_ms":  time.Since(start).Milliseconds(),
+		})
+	}
+}
+
+// applyCacheValidation sets cache headers when caching applies to the request and
+// handles conditional requests. It returns the cache policy used and whether a
+// 304 Not Modified response has been written.
+func (s *gcsServer) applyCacheValidation(w *responseWriter, r *http.Request, cleanPath string, attrs *storage.ObjectAttrs, start time.Time) (string, bool) {
 	// Check if cache should be applied to this request
 	applyCaching := s.shouldApplyCache(r, cleanPath)
 
@@ -508,7 +755,7 @@ func (s *gcsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	if applyCaching {
 		// Set cache headers
-		cachePolicy = s.setCacheHeadersWithConfig(wrapped, attrs, cleanPath)
+		cachePolicy = s.setCacheHeadersWithConfig(w, attrs, cleanPath)
 		cacheHeadersSet.WithLabelValues(s.bucketName, attrs.ContentType, cachePolicy).Inc()
 
 		// Check conditional requests (cache validation)
@@ -522,8 +769,8 @@ func (s *gcsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Handle cache hit
 	if applyCaching && isNotModified {
 		// Cache hit - return 304 Not Modified
-		wrapped.statusCode = 304
-		wrapped.WriteHeader(http.StatusNotModified)
+		w.statusCode = 304
+		w.WriteHeader(http.StatusNotModified)
 
 		// Track cache hit metrics
 		cacheStatus.WithLabelValues(s.bucketName, cleanPath, "hit").Inc()
@@ -539,7 +786,7 @@ func (s *gcsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"cache_policy": cachePolicy,
 			"duration_ms":  time.Since(start).Milliseconds(),
 		})
-		return
+		return cachePolicy, true
 	}
 
 	// Cache miss - serve full content (only track if caching is enabled)
@@ -550,30 +797,27 @@ func (s *gcsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	wrapped.Header().Set("Content-Type", attrs.ContentType)
-
-	// Copy the object contents to the response while tracking bytes transferred
-	written, err := io.Copy(wrapped, reader)
-	if err != nil {
-		// If we encounter an error during copy, the response might already be partially written
-		// We can't change the status code at this point, but we can log the error
-		wrapped.statusCode = 500
-		s.logError(logging.Error, "copy_contents", cleanPath, http.StatusInternalServerError, err)
-		errorTotal.WithLabelValues(s.bucketName, cleanPath, "copy_error").Inc()
-		requestsTotal.WithLabelValues(s.bucketName, cleanPath, r.Method, "500").Inc()
-	} else {
-		requestsTotal.WithLabelValues(s.bucketName, cleanPath, r.Method, "200").Inc()
-		bytesTransferred.WithLabelValues(s.bucketName, cleanPath, r.Method, "download").Add(float64(written))
+	return cachePolicy, false
+}
 
-		// Log successful request
-		s.logInfo("serve_request", cleanPath, map[string]any{
-			"status":       200,
-			"bytes_served": written,
-			"content_type": attrs.ContentType,
-			"cache_policy": cachePolicy,
-			"duration_ms":  time.Since(start).Milliseconds(),
-		})
+// serveHead answers a HEAD request from object metadata, skipping the content download
+// The length of responses compressed on the fly is unknown without compressing the body.
+func (s *gcsServer) serveHead(w *responseWriter, r *http.Request, cleanPath string, attrs *storage.ObjectAttrs, cachePolicy string, lengthKnown bool, start time.Time) {
+	if lengthKnown {
+		w.Header().Set("Content-Length", strconv.FormatInt(attrs.Size, 10))
 	}
+	w.WriteHeader(http.StatusOK)
+
+	requestsTotal.WithLabelValues(s.bucketName, cleanPath, r.Method, "200").Inc()
+	gcsOperationsSkipped.WithLabelValues(s.bucketName, "content_download").Inc()
+
+	s.logInfo("serve_head", cleanPath, map[string]any{
+		"status":         200,
+		"content_length": attrs.Size,
+		"content_type":   attrs.ContentType,
+		"cache_policy":   cachePolicy,
+		"duration_ms":    time.Since(start).Milliseconds(),
+	})
 }
 
 func readyzHandler(w http.ResponseWriter, r *http.Request) {
@@ -587,8 +831,9 @@ func livezHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // configRedirectsHandler returns the current redirect configuration as JSON
-func configRedirectsHandler(server *gcsServer) http.HandlerFunc {
+func configRedirectsHandler(live *gcsServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		server := live.snapshot()
 		if r.Method != http.MethodGet {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			w.Write([]byte("Method not allowed"))
@@ -597,15 +842,19 @@ func configRedirectsHandler(server *gcsServer) http.HandlerFunc {
 
 		// Create response structure
 		response := struct {
-			Redirects    map[string]string `json:"redirects"`
-			Count        int               `json:"count"`
-			ConfigSource string            `json:"config_source"`
-			BucketName   string            `json:"bucket_name"`
+			Redirects    map[string]string       `json:"redirects"`
+			Rules        map[string]RedirectRule `json:"rules"`
+			Count        int                     `json:"count"`
+			ConfigSource string                  `json:"config_source"`
+			BucketName   string                  `json:"bucket_name"`
+			Warnings     []string                `json:"warnings,omitempty"`
 		}{
-			Redirects:    server.redirects,
+			Redirects:    redirectDestinations(server.redirects),
+			Rules:        server.redirects,
 			Count:        len(server.redirects),
 			ConfigSource: ".spray/redirects.toml",
 			BucketName:   server.bucketName,
+			Warnings:     server.configWarnings(),
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -627,7 +876,7 @@ func configRedirectsHandler(server *gcsServer) http.HandlerFunc {
 func createServer(ctx context.Context, cfg *config, logClient LoggingClient) (*http.Server, error) {
 	logger := logClient.Logger("gcs-server")
 
-	server, err := newGCSServer(ctx, cfg.bucketName, logger, cfg.store, cfg.redirects, cfg.headers)
+	server, err := newGCSServer(ctx, cfg.bucketName, logger, servingStore(cfg), cfg.redirects, cfg.rewrites, cfg.headers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GCS server: %v", err)
 	}
@@ -637,12 +886,23 @@ func createServer(ctx context.Context, cfg *config, logClient LoggingClient) (*h
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.HandleFunc("/readyz", readyzHandler)
 	mux.HandleFunc("/livez", livezHandler)
-	mux.HandleFunc("/config/redirects", configRedirectsHandler(server))
+	serveConfigEndpoints(mux, cfg.configEndpoints, cfg.adminToken, map[string]http.HandlerFunc{
+		"/config":           configHandler(server),
+		"/config/redirects": configRedirectsHandler(server),
+		"/config/headers":   configHeadersHandler(server),
+	})
+	server.site.warnings = cfg.configWarnings
 
-	return &http.Server{
+	srv := &http.Server{
 		Addr:    ":" + cfg.port,
 		Handler: mux,
-	}, nil
+	}
+	if cfg.store != nil {
+		ctx = stopOnShutdown(ctx, srv)
+		server.startConfigReload(ctx, cfg.store, cfg.objectCache, cfg.reloadInterval)
+		serveReloads(ctx, mux, &siteReloader{targets: []reloadTarget{{server: server}}}, cfg.adminToken)
+	}
+	return srv, nil
 }
 
 // handleSignals is a package-level variable to allow overriding in tests.
@@ -724,6 +984,10 @@ func generateETag(attrs *storage.ObjectAttrs) string {
 	// Use object name, size, and updated time for ETag generation
 	// This provides a unique identifier that changes when the object changes
 	data := fmt.Sprintf("%s-%d-%d", attrs.Name, attrs.Size, attrs.Updated.Unix())
+	// Encoded representations of the same object need distinct ETags
+	if attrs.ContentEncoding != "" {
+		data += "-" + attrs.ContentEncoding
+	}
 	hash := md5.Sum([]byte(data))
 	return fmt.Sprintf("\"%x\"", hash)
 }
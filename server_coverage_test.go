@@ -76,7 +76,7 @@ func TestGCSObjectStore_GetObject_ErrorCases(t *testing.T) {
 }
 
 func TestCreateServer(t *testing.T) {
-	ctx := context.Background()
+	ctx := t.Context()
 	logClient := newMockLogClient()
 
 	tests := []struct {
@@ -90,7 +90,7 @@ func TestCreateServer(t *testing.T) {
 				bucketName: "test-bucket",
 				port:       "8080",
 				store:      &mockObjectStore{objects: make(map[string]mockObject)},
-				redirects:  make(map[string]string),
+				redirects:  make(map[string]RedirectRule),
 			},
 			expectError: false,
 		},
@@ -100,7 +100,7 @@ func TestCreateServer(t *testing.T) {
 				bucketName: "test-bucket",
 				port:       "8080",
 				store:      nil,
-				redirects:  make(map[string]string),
+				redirects:  make(map[string]RedirectRule),
 			},
 			expectError: true,
 		},
@@ -135,7 +135,7 @@ func TestCreateServer(t *testing.T) {
 }
 
 func TestSendUserFriendlyError_JSONResponse(t *testing.T) {
-	server := createMockServer(t, make(map[string]mockObject), make(map[string]string))
+	server := createMockServer(t, make(map[string]mockObject), make(map[string]RedirectRule))
 
 	req, err := http.NewRequest("GET", "/test", nil)
 	if err != nil {
@@ -167,7 +167,7 @@ func TestSendUserFriendlyError_JSONResponse(t *testing.T) {
 }
 
 func TestSendUserFriendlyError_HTMLResponse(t *testing.T) {
-	server := createMockServer(t, make(map[string]mockObject), make(map[string]string))
+	server := createMockServer(t, make(map[string]mockObject), make(map[string]RedirectRule))
 
 	req, err := http.NewRequest("GET", "/test", nil)
 	if err != nil {
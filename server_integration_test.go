@@ -54,7 +54,7 @@ func TestGCSIntegration(t *testing.T) {
 	}
 
 	// Create a GCS server for testing
-	server, err := newGCSServer(ctx, bucketName, &gcpLoggerAdapter{logger: logger}, store, make(map[string]string), &HeaderConfig{
+	server, err := newGCSServer(ctx, bucketName, &gcpLoggerAdapter{logger: logger}, store, make(map[string]RedirectRule), nil, &HeaderConfig{
 		PoweredBy: PoweredByConfig{Enabled: true},
 	})
 	require.NoError(t, err, "Failed to create GCS server")
@@ -16,7 +16,7 @@ var DefaultServerSetup ServerSetup = func(ctx context.Context, cfg *config, logC
 	logger := logClient.Logger("gcs-server")
 
 	// Create a new GCS server
-	server, err := newGCSServer(ctx, cfg.bucketName, logger, cfg.store, cfg.redirects, cfg.headers)
+	server, err := newGCSServer(ctx, cfg.bucketName, logger, servingStore(cfg), cfg.redirects, cfg.rewrites, cfg.headers)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GCS server: %v", err)
 	}
@@ -27,10 +27,21 @@ var DefaultServerSetup ServerSetup = func(ctx context.Context, cfg *config, logC
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.HandleFunc("/readyz", readyzHandler)
 	mux.HandleFunc("/livez", livezHandler)
-	mux.HandleFunc("/config/redirects", configRedirectsHandler(server))
+	serveConfigEndpoints(mux, cfg.configEndpoints, cfg.adminToken, map[string]http.HandlerFunc{
+		"/config":           configHandler(server),
+		"/config/redirects": configRedirectsHandler(server),
+		"/config/headers":   configHeadersHandler(server),
+	})
+	server.site.warnings = cfg.configWarnings
 
-	return &http.Server{
+	srv := &http.Server{
 		Addr:    ":" + cfg.port,
 		Handler: mux,
-	}, nil
+	}
+	if cfg.store != nil {
+		ctx = stopOnShutdown(ctx, srv)
+		server.startConfigReload(ctx, cfg.store, cfg.objectCache, cfg.reloadInterval)
+		serveReloads(ctx, mux, &siteReloader{targets: []reloadTarget{{server: server}}}, cfg.adminToken)
+	}
+	return srv, nil
 }
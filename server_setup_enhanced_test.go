@@ -6,14 +6,14 @@ import (
 )
 
 func TestDefaultServerSetup_Success(t *testing.T) {
-	ctx := context.Background()
+	ctx := t.Context()
 
 	// Create test config
 	cfg := &config{
 		bucketName: "test-bucket",
 		port:       "8080",
 		store:      &mockObjectStore{},
-		redirects:  make(map[string]string),
+		redirects:  make(map[string]RedirectRule),
 	}
 
 	// Create mock logging client
@@ -40,12 +40,12 @@ func TestDefaultServerSetup_Success(t *testing.T) {
 }
 
 func TestDefaultServerSetup_WithRedirects(t *testing.T) {
-	ctx := context.Background()
+	ctx := t.Context()
 
 	// Create test config with redirects
-	redirects := map[string]string{
-		"/old-path": "/new-path",
-		"/docs":     "/documentation",
+	redirects := map[string]RedirectRule{
+		"/old-path": {To: "/new-path"},
+		"/docs":     {To: "/documentation"},
 	}
 
 	cfg := &config{
@@ -79,7 +79,7 @@ func TestDefaultServerSetup_NilStore(t *testing.T) {
 		bucketName: "test-bucket",
 		port:       "8080",
 		store:      nil, // This should cause newGCSServer to fail
-		redirects:  make(map[string]string),
+		redirects:  make(map[string]RedirectRule),
 	}
 
 	logClient := newMockLogClient()
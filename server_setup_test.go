@@ -119,7 +119,7 @@ func TestServerSetup(t *testing.T) {
 			DefaultServerSetup = tt.setupServer
 
 			// Create a context
-			ctx := context.Background()
+			ctx := t.Context()
 
 			// Create server with mock setup
 			srv, err := DefaultServerSetup(ctx, tt.cfg, logClient)
@@ -182,7 +182,7 @@ func TestSetupServer(t *testing.T) {
 			setupServer: func(ctx context.Context, cfg *config, logClient LoggingClient) (*http.Server, error) {
 				// Use a mockLogger to avoid panics
 				logger := &mockLogger{}
-				server, err := newGCSServer(ctx, cfg.bucketName, logger, cfg.store, cfg.redirects, cfg.headers)
+				server, err := newGCSServer(ctx, cfg.bucketName, logger, cfg.store, cfg.redirects, cfg.rewrites, cfg.headers)
 				if err != nil {
 					return nil, err
 				}
@@ -246,7 +246,7 @@ func TestSetupServer(t *testing.T) {
 			DefaultServerSetup = tt.setupServer
 
 			// Create a context
-			ctx := context.Background()
+			ctx := t.Context()
 
 			// Create a mock logging client
 			logClient := newMockLogClient()
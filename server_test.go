@@ -13,6 +13,7 @@ import (
 
 	"cloud.google.com/go/storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // mockObject represents a mock object in the store
@@ -48,12 +49,62 @@ type mockObjectStore struct {
 func (s *mockObjectStore) GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error) {
 	if obj, ok := s.objects[path]; ok {
 		return &mockReader{data: obj.data}, &storage.ObjectAttrs{
+			Name:        path,
 			ContentType: obj.contentType,
+			Size:        int64(len(obj.data)),
 		}, nil
 	}
 	return nil, nil, storage.ErrObjectNotExist
 }
 
+func (s *mockObjectStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return getObjectRangeFromFull(s, ctx, path, offset, length)
+}
+
+func (s *mockObjectStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	return getObjectAttrsFromFull(s, ctx, path)
+}
+
+func (s *mockObjectStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	return listMockObjects(s.objects, prefix, pageToken, limit)
+}
+
+// listMockObjects implements ListObjects for mocks holding a map of mockObjects
+func listMockObjects(objects map[string]mockObject, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	entries := listKeys(keys, prefix, func(key string) *storage.ObjectAttrs {
+		return &storage.ObjectAttrs{Name: key, ContentType: objects[key].contentType, Size: int64(len(objects[key].data))}
+	})
+	entries, next := paginateListing(entries, pageToken, limit)
+	return entries, next, nil
+}
+
+// getObjectAttrsFromFull implements GetObjectAttrs for mocks by discarding a GetObject reader
+func getObjectAttrsFromFull(store ObjectStore, ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	reader, attrs, err := store.GetObject(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	reader.Close()
+	return attrs, nil
+}
+
+// getObjectRangeFromFull implements GetObjectRange for mocks by slicing a full GetObject read
+func getObjectRangeFromFull(store ObjectStore, ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	reader, attrs, err := store.GetObject(ctx, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	limited, err := limitObjectReader(reader, offset, length)
+	if err != nil {
+		return nil, nil, err
+	}
+	return limited, attrs, nil
+}
+
 // errorObjectStore implements ObjectStore and always returns an error
 type errorObjectStore struct{}
 
@@ -61,6 +112,18 @@ func (s *errorObjectStore) GetObject(ctx context.Context, path string) (io.ReadC
 	return nil, nil, assert.AnError
 }
 
+func (s *errorObjectStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return nil, nil, assert.AnError
+}
+
+func (s *errorObjectStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	return nil, assert.AnError
+}
+
+func (s *errorObjectStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	return nil, "", assert.AnError
+}
+
 // mockStorageClient implements the StorageClient interface for testing
 type mockStorageClient struct {
 	objects map[string]mockObject
@@ -91,9 +154,19 @@ func (c *mockStorageClient) GetObject(ctx context.Context, path string) (io.Read
 	return nil, nil, storage.ErrObjectNotExist
 }
 
-// ListObjects returns a mock object iterator
-func (c *mockStorageClient) ListObjects(ctx context.Context, prefix string) *storage.ObjectIterator {
-	return &storage.ObjectIterator{}
+// GetObjectRange returns a byte range of a mock object
+func (c *mockStorageClient) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return getObjectRangeFromFull(c, ctx, path, offset, length)
+}
+
+// GetObjectAttrs returns the attributes of a mock object
+func (c *mockStorageClient) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	return getObjectAttrsFromFull(c, ctx, path)
+}
+
+// ListObjects lists the mock objects below prefix
+func (c *mockStorageClient) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	return listMockObjects(c.objects, prefix, pageToken, limit)
 }
 
 // Close closes the client
@@ -102,7 +175,7 @@ func (c *mockStorageClient) Close() error {
 }
 
 // Helper function to create a mock server for testing
-func createMockServer(t *testing.T, objects map[string]mockObject, redirects map[string]string) *gcsServer {
+func createMockServer(t *testing.T, objects map[string]mockObject, redirects map[string]RedirectRule) *gcsServer {
 	store := &mockObjectStore{
 		objects: objects,
 	}
@@ -335,22 +408,22 @@ func TestNewGCSServer(t *testing.T) {
 		PoweredBy: PoweredByConfig{Enabled: true},
 	}
 
-	server, err := newGCSServer(context.Background(), "test-bucket", &mockLogger{}, store, nil, headers)
+	server, err := newGCSServer(context.Background(), "test-bucket", &mockLogger{}, store, nil, nil, headers)
 	assert.NoError(t, err)
 	assert.NotNil(t, server)
 	assert.Equal(t, "test-bucket", server.bucketName)
 
 	// Test with nil store (should return error)
-	server, err = newGCSServer(context.Background(), "test-bucket", &mockLogger{}, nil, nil, headers)
+	server, err = newGCSServer(context.Background(), "test-bucket", &mockLogger{}, nil, nil, nil, headers)
 	assert.Error(t, err)
 	assert.Nil(t, server)
 	assert.Contains(t, err.Error(), "store cannot be nil")
 
 	// Test with redirects
-	redirects := map[string]string{
-		"/old": "/new",
+	redirects := map[string]RedirectRule{
+		"/old": {To: "/new"},
 	}
-	server, err = newGCSServer(context.Background(), "test-bucket", &mockLogger{}, store, redirects, headers)
+	server, err = newGCSServer(context.Background(), "test-bucket", &mockLogger{}, store, redirects, nil, headers)
 	assert.NoError(t, err)
 	assert.NotNil(t, server)
 	assert.Equal(t, redirects, server.redirects)
@@ -377,7 +450,7 @@ func TestNewGCSServer_ErrorPath(t *testing.T) {
 		PoweredBy: PoweredByConfig{Enabled: true},
 	}
 
-	server, err := newGCSServer(context.Background(), "test-bucket", &mockLogger{}, nil, nil, headers)
+	server, err := newGCSServer(context.Background(), "test-bucket", &mockLogger{}, nil, nil, nil, headers)
 	assert.Error(t, err)
 	assert.Nil(t, server)
 }
@@ -447,8 +520,8 @@ func TestGCSObjectStoreGetObject(t *testing.T) {
 func TestServeHTTP_Redirects(t *testing.T) {
 	// Create a server with redirects
 	// Note: cleanRequestPath converts "/old-path" to "old-path" (removes leading slash)
-	redirects := map[string]string{
-		"old-path": "https://example.com/new-path",
+	redirects := map[string]RedirectRule{
+		"old-path": {To: "https://example.com/new-path"},
 	}
 	server := &gcsServer{
 		store:      &mockObjectStore{objects: make(map[string]mockObject)},
@@ -473,10 +546,10 @@ func TestServeHTTP_Redirects(t *testing.T) {
 
 func TestConfigRedirectsHandler(t *testing.T) {
 	// Create a server with some redirects
-	redirects := map[string]string{
-		"/old-path":     "https://example.com/new-path",
-		"/github":       "https://github.com/picotechllc/spray",
-		"/another-path": "https://example.com/destination",
+	redirects := map[string]RedirectRule{
+		"/old-path":     {To: "https://example.com/new-path"},
+		"/github":       {To: "https://github.com/picotechllc/spray", Status: http.StatusMovedPermanently},
+		"/another-path": {To: "https://example.com/destination"},
 	}
 
 	server := &gcsServer{
@@ -502,17 +575,23 @@ func TestConfigRedirectsHandler(t *testing.T) {
 
 	// Parse the response
 	var response struct {
-		Redirects    map[string]string `json:"redirects"`
-		Count        int               `json:"count"`
-		ConfigSource string            `json:"config_source"`
-		BucketName   string            `json:"bucket_name"`
+		Redirects    map[string]string       `json:"redirects"`
+		Rules        map[string]RedirectRule `json:"rules"`
+		Count        int                     `json:"count"`
+		ConfigSource string                  `json:"config_source"`
+		BucketName   string                  `json:"bucket_name"`
 	}
 
 	err := json.Unmarshal(rr.Body.Bytes(), &response)
 	assert.NoError(t, err)
 
 	// Verify the response content
-	assert.Equal(t, redirects, response.Redirects)
+	assert.Equal(t, map[string]string{
+		"/old-path":     "https://example.com/new-path",
+		"/github":       "https://github.com/picotechllc/spray",
+		"/another-path": "https://example.com/destination",
+	}, response.Redirects)
+	assert.Equal(t, redirects, response.Rules)
 	assert.Equal(t, len(redirects), response.Count)
 	assert.Equal(t, ".spray/redirects.toml", response.ConfigSource)
 	assert.Equal(t, "test-bucket", response.BucketName)
@@ -521,7 +600,7 @@ func TestConfigRedirectsHandler(t *testing.T) {
 func TestConfigRedirectsHandler_MethodNotAllowed(t *testing.T) {
 	server := &gcsServer{
 		bucketName: "test-bucket",
-		redirects:  map[string]string{},
+		redirects:  map[string]RedirectRule{},
 		logger:     &mockLogger{},
 	}
 
@@ -541,7 +620,7 @@ func TestConfigRedirectsHandler_MethodNotAllowed(t *testing.T) {
 func TestConfigRedirectsHandler_EmptyRedirects(t *testing.T) {
 	server := &gcsServer{
 		bucketName: "test-bucket",
-		redirects:  map[string]string{}, // Empty redirects
+		redirects:  map[string]RedirectRule{}, // Empty redirects
 		logger:     &mockLogger{},
 	}
 
@@ -615,3 +694,113 @@ func TestGCSObjectStore_GetObject_UnauthenticatedAccess(t *testing.T) {
 		})
 	}
 }
+
+// countingObjectStore records how often object bodies are opened
+type countingObjectStore struct {
+	mockObjectStore
+	bodyOpens int
+}
+
+func (s *countingObjectStore) GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	s.bodyOpens++
+	return s.mockObjectStore.GetObject(ctx, path)
+}
+
+func (s *countingObjectStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	s.bodyOpens++
+	return s.mockObjectStore.GetObjectRange(ctx, path, offset, length)
+}
+
+func (s *countingObjectStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	if obj, ok := s.objects[path]; ok {
+		return &storage.ObjectAttrs{
+			Name:        path,
+			ContentType: obj.contentType,
+			Size:        int64(len(obj.data)),
+			Updated:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		}, nil
+	}
+	return nil, storage.ErrObjectNotExist
+}
+
+func TestServeHTTP_Head(t *testing.T) {
+	store := &countingObjectStore{mockObjectStore: mockObjectStore{objects: map[string]mockObject{
+		"index.html": {data: []byte("<h1>Hello</h1>"), contentType: "text/html"},
+	}}}
+	headers := getDefaultHeaderConfig()
+	headers.Cache.Enabled = true
+	server := &gcsServer{
+		store:      store,
+		bucketName: "test-bucket",
+		logger:     &mockLogger{},
+		headers:    headers,
+	}
+
+	t.Run("metadata without body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodHead, "/", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "text/html", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "14", rr.Header().Get("Content-Length"))
+		assert.Equal(t, "bytes", rr.Header().Get("Accept-Ranges"))
+		assert.NotEmpty(t, rr.Header().Get("ETag"))
+		assert.NotEmpty(t, rr.Header().Get("Cache-Control"))
+		assert.Empty(t, rr.Body.String())
+	})
+
+	t.Run("conditional request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodHead, "/index.html", nil)
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+
+		req = httptest.NewRequest(http.MethodHead, "/index.html", nil)
+		req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+		rr = httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+	})
+
+	t.Run("missing object", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodHead, "/missing.html", nil)
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	assert.Zero(t, store.bodyOpens, "HEAD requests must not open object bodies")
+}
+
+func TestServeHTTP_ConditionalGetSkipsBody(t *testing.T) {
+	store := &countingObjectStore{mockObjectStore: mockObjectStore{objects: map[string]mockObject{
+		"app.js": {data: []byte("console.log(1)"), contentType: "application/javascript"},
+	}}}
+	headers := getDefaultHeaderConfig()
+	headers.Cache.Enabled = true
+	server := &gcsServer{
+		store:      store,
+		bucketName: "test-bucket",
+		logger:     &mockLogger{},
+		headers:    headers,
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "console.log(1)", rr.Body.String())
+	assert.Equal(t, 1, store.bodyOpens, "a 200 response opens the body exactly once")
+
+	etag := rr.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	req = httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	server.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.String())
+	assert.Equal(t, 1, store.bodyOpens, "a 304 response must not open the body")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// defaultSPAFallback is the object served for unknown paths when none is configured
+const defaultSPAFallback = "index.html"
+
+// defaultSPAAssetExtensions are extensions that keep returning 404 instead of the fallback,
+// so a missing script or image is not answered with HTML
+var defaultSPAAssetExtensions = []string{
+	"js", "mjs", "css", "map", "json", "xml", "txt",
+	"png", "jpg", "jpeg", "gif", "svg", "webp", "avif", "ico",
+	"woff", "woff2", "ttf", "otf", "eot",
+	"mp4", "webm", "mp3", "wasm", "pdf", "zip",
+}
+
+// SPAConfig controls serving a fallback object for paths without an object, so
+// client-side routes of single-page applications can be deep linked
+type SPAConfig struct {
+	Enabled         bool     `toml:"enabled" json:"enabled"`
+	Fallback        string   `toml:"fallback" json:"fallback"`                 // object key, default: index.html
+	Prefixes        []string `toml:"prefixes" json:"prefixes"`                 // request path prefixes, default: the whole site
+	AssetExtensions []string `toml:"asset_extensions" json:"asset_extensions"` // extensions without a fallback, default: common asset types
+}
+
+// spaFallback returns the fallback object for a request whose object does not exist,
+// or false when the SPA fallback does not apply to it
+func (s *gcsServer) spaFallback(r *http.Request, cleanPath string) (string, bool) {
+	if s.headers == nil || !s.headers.SPA.Enabled {
+		return "", false
+	}
+	config := &s.headers.SPA
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "", false
+	}
+
+	fallback := strings.TrimPrefix(config.Fallback, "/")
+	if fallback == "" {
+		fallback = defaultSPAFallback
+	}
+	if cleanPath == fallback {
+		return "", false
+	}
+
+	requestPath := strings.TrimSuffix(redirectMatchPath(r.URL.Path, cleanPath), "/")
+	if !spaPrefixMatches(requestPath, config.Prefixes) {
+		return "", false
+	}
+
+	extensions := config.AssetExtensions
+	if extensions == nil {
+		extensions = defaultSPAAssetExtensions
+	}
+	if ext := strings.ToLower(strings.TrimPrefix(path.Ext(requestPath), ".")); ext != "" {
+		for _, asset := range extensions {
+			if strings.ToLower(strings.TrimPrefix(asset, ".")) == ext {
+				return "", false
+			}
+		}
+	}
+
+	return fallback, true
+}
+
+// spaPrefixMatches reports whether a request path (without leading slash) is below one
+// of the prefixes. Prefixes match whole path segments; no prefixes match every path.
+func spaPrefixMatches(requestPath string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(prefix, "/")
+		if prefix == "" || requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSPAPrefixMatches(t *testing.T) {
+	assert.True(t, spaPrefixMatches("anything/at/all", nil))
+	assert.True(t, spaPrefixMatches("app", []string{"/app/"}))
+	assert.True(t, spaPrefixMatches("app/settings", []string{"/app"}))
+	assert.True(t, spaPrefixMatches("dashboard/x", []string{"/app", "dashboard"}))
+	assert.False(t, spaPrefixMatches("application", []string{"/app"}))
+	assert.False(t, spaPrefixMatches("blog/post", []string{"/app"}))
+}
+
+func TestServeHTTP_SPAFallback(t *testing.T) {
+	const bucket = "spa-bucket"
+	objects := map[string]mockObject{
+		"index.html":     {data: []byte("root shell"), contentType: "text/html"},
+		"app/index.html": {data: []byte("app shell"), contentType: "text/html"},
+		"app/main.js":    {data: []byte("console.log(1)"), contentType: "application/javascript"},
+	}
+	headers := getDefaultHeaderConfig()
+	headers.SPA.Enabled = true
+	server := &gcsServer{
+		store:      &mockObjectStore{objects: objects},
+		bucketName: bucket,
+		logger:     &mockLogger{},
+		headers:    headers,
+	}
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	t.Run("deep links serve the fallback", func(t *testing.T) {
+		before := testutil.ToFloat64(spaFallbacks.WithLabelValues(bucket))
+		for _, path := range []string{"/dashboard/settings", "/users/john.doe", "/reports/", "/page.html"} {
+			rr := serve(http.MethodGet, path)
+			assert.Equal(t, http.StatusOK, rr.Code, path)
+			assert.Equal(t, "root shell", rr.Body.String(), path)
+			assert.Equal(t, "text/html", rr.Header().Get("Content-Type"), path)
+		}
+		assert.Equal(t, before+4, testutil.ToFloat64(spaFallbacks.WithLabelValues(bucket)))
+	})
+
+	t.Run("existing objects are served", func(t *testing.T) {
+		assert.Equal(t, "console.log(1)", serve(http.MethodGet, "/app/main.js").Body.String())
+	})
+
+	t.Run("missing assets still 404", func(t *testing.T) {
+		for _, path := range []string{"/app/missing.js", "/logo.PNG", "/styles/site.css"} {
+			assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, path).Code, path)
+		}
+	})
+
+	t.Run("HEAD is answered, other methods are not", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(http.MethodHead, "/dashboard").Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "/dashboard").Code)
+	})
+
+	t.Run("prefixes and fallback", func(t *testing.T) {
+		headers.SPA.Prefixes = []string{"/app"}
+		headers.SPA.Fallback = "/app/index.html"
+		defer func() {
+			headers.SPA.Prefixes = nil
+			headers.SPA.Fallback = ""
+		}()
+
+		rr := serve(http.MethodGet, "/app/dashboard")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "app shell", rr.Body.String())
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/dashboard").Code)
+	})
+
+	t.Run("configured asset extensions", func(t *testing.T) {
+		headers.SPA.AssetExtensions = []string{".map"}
+		defer func() { headers.SPA.AssetExtensions = nil }()
+
+		assert.Equal(t, http.StatusOK, serve(http.MethodGet, "/missing.js").Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/missing.js.map").Code)
+	})
+
+	t.Run("missing fallback object", func(t *testing.T) {
+		headers.SPA.Fallback = "shell.html"
+		defer func() { headers.SPA.Fallback = "" }()
+
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/dashboard").Code)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		headers.SPA.Enabled = false
+		defer func() { headers.SPA.Enabled = true }()
+
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/dashboard").Code)
+	})
+}
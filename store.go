@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+const (
+	sourceSchemeGCS  = "gs"
+	sourceSchemeFile = "file"
+	sourceSchemeS3   = "s3"
+)
+
+// sourceSpec describes where spray reads site content from
+type sourceSpec struct {
+	scheme   string // gs, s3 or file
+	location string // bucket name for gs and s3, directory for file
+}
+
+// parseSource parses a --source / SPRAY_SOURCE value such as "gs://my-bucket",
+// "s3://my-bucket" or "file:///srv/site". An empty value selects GCS with the bucket taken from BUCKET_NAME.
+func parseSource(raw string) (sourceSpec, error) {
+	if raw == "" {
+		return sourceSpec{scheme: sourceSchemeGCS}, nil
+	}
+
+	scheme, location, found := strings.Cut(raw, "://")
+	if !found {
+		return sourceSpec{}, fmt.Errorf("invalid source %q: expected scheme://location", raw)
+	}
+
+	switch scheme {
+	case sourceSchemeGCS, sourceSchemeS3:
+		if location == "" || strings.Contains(location, "/") {
+			return sourceSpec{}, fmt.Errorf("invalid source %q: expected %s://bucket-name", raw, scheme)
+		}
+	case sourceSchemeFile:
+		if location == "" {
+			return sourceSpec{}, fmt.Errorf("invalid source %q: directory is required", raw)
+		}
+	default:
+		return sourceSpec{}, fmt.Errorf("unsupported source scheme %q", scheme)
+	}
+
+	return sourceSpec{scheme: scheme, location: location}, nil
+}
+
+// createObjectStore builds the ObjectStore for the configured source.
+// The returned close function releases any client the store depends on.
+func createObjectStore(ctx context.Context, cfg *config) (ObjectStore, func() error, error) {
+	src, err := parseSource(cfg.source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch src.scheme {
+	case sourceSchemeFile:
+		store, err := newFileObjectStore(src.location)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func() error { return nil }, nil
+	case sourceSchemeS3:
+		store, err := newS3ObjectStore(src.location, s3OptionsFromEnv())
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func() error { return nil }, nil
+	}
+
+	// Create storage client
+	storageClient, err := storageClientFactory(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create storage client: %v", err)
+	}
+
+	return newGCSObjectStore(storageClient, cfg.bucketName), storageClient.Close, nil
+}
+
+// newGCSObjectStore returns the store for a bucket served through storageClient
+func newGCSObjectStore(storageClient StorageClient, bucketName string) ObjectStore {
+	if os.Getenv("STORAGE_MOCK") == "true" {
+		return newDebugMockObjectStore(bucketName)
+	}
+
+	return &GCSObjectStore{
+		bucket: storageClient.Bucket(bucketName),
+	}
+}
+
+// listEntryKey returns the key a listing entry sorts by: the object name or the subdirectory prefix
+func listEntryKey(attrs *storage.ObjectAttrs) string {
+	if attrs.Prefix != "" {
+		return attrs.Prefix
+	}
+	return attrs.Name
+}
+
+// listKeys builds a one-level listing of the keys below prefix, collapsing deeper
+// keys into subdirectory entries. attrsFor supplies the attributes of each object.
+func listKeys(keys []string, prefix string, attrsFor func(key string) *storage.ObjectAttrs) []*storage.ObjectAttrs {
+	var entries []*storage.ObjectAttrs
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		if dir, _, nested := strings.Cut(rest, "/"); nested {
+			if !seen[dir] {
+				seen[dir] = true
+				entries = append(entries, &storage.ObjectAttrs{Prefix: prefix + dir + "/"})
+			}
+			continue
+		}
+		entries = append(entries, attrsFor(key))
+	}
+	sort.Slice(entries, func(i, j int) bool { return listEntryKey(entries[i]) < listEntryKey(entries[j]) })
+	return entries
+}
+
+// paginateListing returns at most limit sorted entries following pageToken, which is
+// the key of the last entry of the previous page, and the token for the next page
+func paginateListing(entries []*storage.ObjectAttrs, pageToken string, limit int) ([]*storage.ObjectAttrs, string) {
+	start := sort.Search(len(entries), func(i int) bool { return listEntryKey(entries[i]) > pageToken })
+	entries = entries[start:]
+	if limit <= 0 || len(entries) <= limit {
+		return entries, ""
+	}
+	entries = entries[:limit]
+	return entries, listEntryKey(entries[limit-1])
+}
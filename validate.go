@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+)
+
+const (
+	severityError   = "error"   // the server refuses to load the configuration
+	severityWarning = "warning" // the configuration loads but does not do what it says
+
+	// maxRedirectHops is how many redirects in a row are followed before a chain counts as a loop
+	maxRedirectHops = 10
+
+	// Exit codes of spray validate
+	validateExitErrors   = 1
+	validateExitWarnings = 2
+)
+
+// exitCodeError ends a command with an exit code once its output has been written
+type exitCodeError struct {
+	code int
+}
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// configProblem is something wrong with a configuration file found by spray validate
+type configProblem struct {
+	file     string
+	severity string
+	message  string
+}
+
+func (p configProblem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.file, p.severity, p.message)
+}
+
+// validateRedirectsConfig checks the contents of a redirects.toml file
+func validateRedirectsConfig(file string, data []byte) []configProblem {
+	problem := func(severity, format string, args ...any) configProblem {
+		return configProblem{file: file, severity: severity, message: fmt.Sprintf(format, args...)}
+	}
+
+	var redirectConfig RedirectConfig
+	md, err := toml.Decode(string(data), &redirectConfig)
+	if err != nil {
+		return []configProblem{problem(severityError, "%v", err)}
+	}
+
+	var problems []configProblem
+	for _, key := range undecodedKeys(md) {
+		problems = append(problems, problem(severityWarning, "unknown key %q", key))
+	}
+
+	paths := sortedRedirectPaths(redirectConfig.Redirects)
+	redirects := make(map[string]RedirectRule, len(paths))
+	written := make(map[string]string, len(paths)) // cleaned path -> path as written
+	invalid := false
+	for _, path := range paths {
+		rule := redirectConfig.Redirects[path]
+		if _, err := validateRedirectRule(path, rule); err != nil {
+			problems = append(problems, problem(severityError, "%v", err))
+			invalid = true
+			continue
+		}
+		cleanedPath := cleanRedirectPath(path)
+		if other, exists := written[cleanedPath]; exists {
+			problems = append(problems, problem(severityWarning, "redirects %q and %q match the same path; only one of them is used", other, path))
+			continue
+		}
+		written[cleanedPath] = path
+		redirects[cleanedPath] = rule
+	}
+	if invalid {
+		// Loops and shadowing are only meaningful for a configuration that loads
+		return problems
+	}
+
+	patterns, err := compileRedirectPatterns(redirects)
+	if err != nil {
+		return append(problems, problem(severityError, "%v", err))
+	}
+	for i, pattern := range patterns {
+		for _, earlier := range patterns[:i] {
+			if patternCovers(earlier, pattern) {
+				problems = append(problems, problem(severityWarning, "redirect %q is shadowed by %q and never matches", "/"+pattern.path, "/"+earlier.path))
+				break
+			}
+		}
+	}
+
+	// Follow the redirects from every exact rule and from a sample request for every pattern
+	var starts []string
+	for _, path := range sortedRedirectPaths(redirects) {
+		if !isRedirectPattern(path) {
+			starts = append(starts, "/"+path)
+		}
+	}
+	for _, pattern := range patterns {
+		starts = append(starts, samplePatternURL(pattern))
+	}
+
+	server := &gcsServer{redirects: redirects, redirectPatterns: patterns}
+	reported := make(map[string]bool)
+	for _, start := range starts {
+		if reported[start] {
+			continue
+		}
+		chain, loops := followRedirects(server, start)
+		if !loops {
+			continue
+		}
+		for _, link := range chain {
+			reported[link] = true
+		}
+		if last := chain[len(chain)-1]; slices.Index(chain, last) == len(chain)-1 {
+			problems = append(problems, problem(severityWarning, "redirects from %q do not end after %d hops: %s", start, maxRedirectHops, strings.Join(chain, " -> ")))
+			continue
+		}
+		problems = append(problems, problem(severityWarning, "redirect loop: %s", strings.Join(chain, " -> ")))
+	}
+	return problems
+}
+
+// sortedRedirectPaths returns the paths of redirects in order
+func sortedRedirectPaths(redirects map[string]RedirectRule) []string {
+	paths := make([]string, 0, len(redirects))
+	for path := range redirects {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// patternCovers reports whether every request matched by later is also matched by
+// earlier, so that later never applies when earlier takes precedence
+func patternCovers(earlier, later redirectPattern) bool {
+	for name, want := range earlier.query {
+		got, ok := later.query[name]
+		switch {
+		case !ok:
+			return false
+		case strings.HasPrefix(want, ":"):
+			// A placeholder needs a value; "" in later also accepts an empty one
+			if got == "" {
+				return false
+			}
+		case want != "" && got != want:
+			return false
+		}
+	}
+
+	for i, segment := range earlier.segments {
+		if segment == splatSegment {
+			return true
+		}
+		if i >= len(later.segments) || later.segments[i] == splatSegment {
+			return false
+		}
+		if strings.HasPrefix(segment, ":") {
+			continue
+		}
+		if later.segments[i] != segment {
+			return false
+		}
+	}
+	return len(later.segments) == len(earlier.segments)
+}
+
+// samplePatternURL returns a request URL matched by pattern, with placeholders and
+// the splat filled in
+func samplePatternURL(pattern redirectPattern) string {
+	segments := make([]string, len(pattern.segments))
+	for i, segment := range pattern.segments {
+		if segment == splatSegment || strings.HasPrefix(segment, ":") {
+			segment = "sample"
+		}
+		segments[i] = segment
+	}
+
+	query := url.Values{}
+	for name, value := range pattern.query {
+		if value == "" || strings.HasPrefix(value, ":") {
+			value = "sample"
+		}
+		query.Set(name, value)
+	}
+
+	sample := "/" + strings.Join(segments, "/")
+	if len(query) > 0 {
+		sample += "?" + query.Encode()
+	}
+	return sample
+}
+
+// followRedirects follows the redirects of server from start while they stay on the
+// site. It returns the URLs visited and whether they loop, either back to a URL
+// already visited or for more than maxRedirectHops.
+func followRedirects(server *gcsServer, start string) ([]string, bool) {
+	chain := []string{start}
+	visited := map[string]bool{start: true}
+	current := start
+
+	for range maxRedirectHops {
+		u, err := url.Parse(current)
+		if err != nil {
+			return chain, false
+		}
+		cleanPath, err := cleanRequestPath(u.EscapedPath())
+		if err != nil {
+			return chain, false
+		}
+		_, rule, ok := server.findRedirect(&http.Request{URL: u}, cleanPath)
+		if !ok {
+			return chain, false
+		}
+
+		next, err := url.Parse(rule.location(u.RawQuery))
+		if err != nil || next.Host != "" || !strings.HasPrefix(next.Path, "/") {
+			// Redirects to other sites end the chain
+			return chain, false
+		}
+		current = next.RequestURI()
+		chain = append(chain, current)
+		if visited[current] {
+			return chain, true
+		}
+		visited[current] = true
+	}
+	return chain, true
+}
+
+// validateRewritesConfig checks the contents of a rewrites.toml file
+func validateRewritesConfig(file string, data []byte) []configProblem {
+	problem := func(severity, format string, args ...any) configProblem {
+		return configProblem{file: file, severity: severity, message: fmt.Sprintf(format, args...)}
+	}
+
+	var rewriteConfig RewriteConfig
+	md, err := toml.Decode(string(data), &rewriteConfig)
+	if err != nil {
+		return []configProblem{problem(severityError, "%v", err)}
+	}
+
+	var problems []configProblem
+	for _, key := range undecodedKeys(md) {
+		problems = append(problems, problem(severityWarning, "unknown key %q", key))
+	}
+
+	paths := make([]string, 0, len(rewriteConfig.Rewrites))
+	for path := range rewriteConfig.Rewrites {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	rewrites := make(map[string]string, len(paths))
+	written := make(map[string]string, len(paths)) // cleaned path -> path as written
+	invalid := false
+	for _, path := range paths {
+		target := rewriteConfig.Rewrites[path]
+		if _, err := validateRewriteRule(path, target); err != nil {
+			problems = append(problems, problem(severityError, "%v", err))
+			invalid = true
+			continue
+		}
+		cleanedPath := cleanRedirectPath(path)
+		if other, exists := written[cleanedPath]; exists {
+			problems = append(problems, problem(severityWarning, "rewrites %q and %q match the same path; only one of them is used", other, path))
+			continue
+		}
+		written[cleanedPath] = path
+		rewrites[cleanedPath] = strings.TrimPrefix(target, "/")
+	}
+	if invalid {
+		return problems
+	}
+
+	patterns, err := compileRewrites(rewrites)
+	if err != nil {
+		return append(problems, problem(severityError, "%v", err))
+	}
+	for i, pattern := range patterns {
+		for _, earlier := range patterns[:i] {
+			if patternCovers(earlier, pattern) {
+				problems = append(problems, problem(severityWarning, "rewrite %q is shadowed by %q and never matches", "/"+pattern.path, "/"+earlier.path))
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// validateHeadersConfig checks the contents of a headers.toml file
+func validateHeadersConfig(file string, data []byte) []configProblem {
+	problem := func(severity, format string, args ...any) configProblem {
+		return configProblem{file: file, severity: severity, message: fmt.Sprintf(format, args...)}
+	}
+
+	var headerConfig HeaderConfig
+	md, err := toml.Decode(string(data), &headerConfig)
+	if err != nil {
+		return []configProblem{problem(severityError, "%v", err)}
+	}
+
+	var problems []configProblem
+	for _, key := range undecodedKeys(md) {
+		problems = append(problems, problem(severityWarning, "unknown key %q", key))
+	}
+	if _, err := validateHeaderConfig(&headerConfig, file); err != nil {
+		problems = append(problems, problem(severityError, "%v", err))
+	}
+
+	rollout := headerConfig.Cache.RolloutConfig
+	if rollout.Percentage < 0 || rollout.Percentage > 100 {
+		problems = append(problems, problem(severityWarning, "cache.rollout.percentage %d is out of range: must be between 0 and 100", rollout.Percentage))
+	}
+	for _, rule := range rollout.UserAgentRules {
+		if _, err := regexp.Compile(rule); err != nil {
+			problems = append(problems, problem(severityWarning, "cache.rollout.user_agent_rules %q never matches: %v", rule, err))
+		}
+	}
+	return problems
+}
+
+// validateStoreConfig checks the configuration files in the .spray directory of store.
+// Missing files are skipped.
+func validateStoreConfig(ctx context.Context, store ObjectStore) ([]configProblem, error) {
+	var problems []configProblem
+	for name, validate := range map[string]func(string, []byte) []configProblem{
+		redirectsFile: validateRedirectsConfig,
+		rewritesFile:  validateRewritesConfig,
+		headersFile:   validateHeadersConfig,
+	} {
+		key := filepath.Join(configDir, name)
+		reader, _, err := store.GetObject(ctx, key)
+		if err == storage.ErrObjectNotExist {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", key, err)
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", key, err)
+		}
+		problems = append(problems, validate(key, data)...)
+	}
+	return problems, nil
+}
+
+// validateOptions selects the configuration checked by spray validate
+type validateOptions struct {
+	dir       string // site directory containing .spray
+	source    string // content source, e.g. gs://bucket; overrides dir
+	redirects string // redirects.toml file; with rewrites and headers, overrides dir
+	rewrites  string // rewrites.toml file
+	headers   string // headers.toml file
+}
+
+// runValidate checks the configuration selected by opts, writes the problems found to
+// out and returns the exit code: 0 when clean, validateExitErrors when the server would
+// refuse the configuration and validateExitWarnings when there are only warnings
+func runValidate(ctx context.Context, out io.Writer, opts validateOptions) (int, error) {
+	var problems []configProblem
+	switch {
+	case opts.redirects != "" || opts.rewrites != "" || opts.headers != "":
+		for _, file := range []struct {
+			path     string
+			validate func(string, []byte) []configProblem
+		}{
+			{opts.redirects, validateRedirectsConfig},
+			{opts.rewrites, validateRewritesConfig},
+			{opts.headers, validateHeadersConfig},
+		} {
+			if file.path == "" {
+				continue
+			}
+			data, err := os.ReadFile(file.path)
+			if err != nil {
+				return 0, err
+			}
+			problems = append(problems, file.validate(file.path, data)...)
+		}
+	default:
+		cfg := &config{source: opts.source}
+		if cfg.source == "" {
+			cfg.source = "file://" + opts.dir
+		}
+		src, err := parseSource(cfg.source)
+		if err != nil {
+			return 0, err
+		}
+		cfg.bucketName = src.location
+		store, closeStore, err := createObjectStore(ctx, cfg)
+		if err != nil {
+			return 0, err
+		}
+		defer closeStore()
+		if problems, err = validateStoreConfig(ctx, store); err != nil {
+			return 0, err
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].file < problems[j].file })
+	errorCount, warningCount := 0, 0
+	for _, p := range problems {
+		fmt.Fprintln(out, p)
+		if p.severity == severityError {
+			errorCount++
+		} else {
+			warningCount++
+		}
+	}
+	fmt.Fprintf(out, "%d error(s), %d warning(s)\n", errorCount, warningCount)
+
+	switch {
+	case errorCount > 0:
+		return validateExitErrors, nil
+	case warningCount > 0:
+		return validateExitWarnings, nil
+	}
+	return 0, nil
+}
+
+// newValidateCommand returns the validate subcommand, which checks .spray configuration
+// before it is deployed
+func newValidateCommand() *cobra.Command {
+	var opts validateOptions
+	cmd := &cobra.Command{
+		Use:   "validate [site directory]",
+		Short: "Check .spray configuration files for mistakes",
+		Long: "Check redirects.toml, rewrites.toml and headers.toml with the parsing used by the server.\n" +
+			"Exits 1 when the server would refuse the configuration and 2 when there are only warnings.",
+		Args: cobra.MaximumNArgs(1),
+		// The problems found are the output; the exit code is reported through exitCodeError
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.dir = "."
+			if len(args) == 1 {
+				opts.dir = args[0]
+			}
+			code, err := runValidate(cmd.Context(), cmd.OutOrStdout(), opts)
+			if err != nil {
+				return err
+			}
+			if code != 0 {
+				return exitCodeError{code: code}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&opts.source, "source", "", "Validate the .spray directory of a content source, e.g. gs://bucket")
+	cmd.Flags().StringVar(&opts.redirects, "redirects", "", "Validate this redirects.toml file")
+	cmd.Flags().StringVar(&opts.rewrites, "rewrites", "", "Validate this rewrites.toml file")
+	cmd.Flags().StringVar(&opts.headers, "headers", "", "Validate this headers.toml file")
+	return cmd
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// problemMessages returns the messages of problems with the given severity
+func problemMessages(problems []configProblem, severity string) []string {
+	var messages []string
+	for _, p := range problems {
+		if p.severity == severity {
+			messages = append(messages, p.message)
+		}
+	}
+	return messages
+}
+
+func TestValidateRedirectsConfig(t *testing.T) {
+	t.Run("clean configuration", func(t *testing.T) {
+		problems := validateRedirectsConfig("redirects.toml", []byte(`
+[redirects]
+"/old" = "/new"
+"/blog/*" = { to = "/posts/:splat", status = 301 }
+"/external" = "https://example.com/"
+`))
+		assert.Empty(t, problems)
+	})
+
+	t.Run("syntax errors", func(t *testing.T) {
+		problems := validateRedirectsConfig("redirects.toml", []byte("[redirects\n"))
+		require.Len(t, problems, 1)
+		assert.Equal(t, severityError, problems[0].severity)
+		assert.True(t, strings.HasPrefix(problems[0].String(), "redirects.toml: error: "))
+	})
+
+	t.Run("every invalid rule is reported", func(t *testing.T) {
+		problems := validateRedirectsConfig("redirects.toml", []byte(`
+[redirects]
+"/a" = "not a url"
+"/b" = { to = "/x", status = 200 }
+"/c" = { to = "/x", query = "keep" }
+"/d/*/e" = "/x"
+`))
+		errors := problemMessages(problems, severityError)
+		require.Len(t, errors, 4)
+		assert.Contains(t, errors[0], "invalid redirect destination URL")
+		assert.Contains(t, errors[1], "invalid redirect status 200")
+		assert.Contains(t, errors[2], "invalid redirect query mode")
+		assert.Contains(t, errors[3], "* must be the last segment")
+	})
+
+	t.Run("unknown keys", func(t *testing.T) {
+		problems := validateRedirectsConfig("redirects.toml", []byte("[redirect]\n\"/a\" = \"/b\"\n"))
+		assert.Equal(t, []string{`unknown key "redirect"`}, problemMessages(problems, severityWarning))
+	})
+
+	t.Run("loops", func(t *testing.T) {
+		problems := validateRedirectsConfig("redirects.toml", []byte(`
+[redirects]
+"/a" = "/b"
+"/b" = "/a"
+"/self" = "/self"
+"/docs/*" = "/docs/:splat"
+"/grow/*" = "/grow/more/:splat"
+"/fine" = "/a-page"
+`))
+		assert.ElementsMatch(t, []string{
+			"redirect loop: /a -> /b -> /a",
+			"redirect loop: /self -> /self",
+			"redirect loop: /docs/sample -> /docs/sample",
+			`redirects from "/grow/sample" do not end after 10 hops: /grow/sample -> /grow/more/sample -> /grow/more/more/sample -> /grow/more/more/more/sample -> /grow/more/more/more/more/sample -> /grow/more/more/more/more/more/sample -> /grow/more/more/more/more/more/more/sample -> /grow/more/more/more/more/more/more/more/sample -> /grow/more/more/more/more/more/more/more/more/sample -> /grow/more/more/more/more/more/more/more/more/more/sample -> /grow/more/more/more/more/more/more/more/more/more/more/sample`,
+		}, problemMessages(problems, severityWarning))
+	})
+
+	t.Run("shadowed rules", func(t *testing.T) {
+		problems := validateRedirectsConfig("redirects.toml", []byte(`
+[redirects]
+"/docs/*" = "https://docs.example.com/:splat"
+"/docs/:version/guide" = "https://guide.example.com/:version"
+"/shop/:item" = "https://shop.example.com/:item"
+"/shop/:id" = "https://shop.example.com/id/:id"
+"/search?q=:term" = "https://search.example.com/?q=:term"
+"/search?q=:term&lang=en" = "https://search.example.com/en?q=:term"
+"/old" = "/new"
+"old" = "/newer"
+`))
+		assert.ElementsMatch(t, []string{
+			`redirect "/shop/:item" is shadowed by "/shop/:id" and never matches`,
+			`redirects "/old" and "old" match the same path; only one of them is used`,
+		}, problemMessages(problems, severityWarning))
+	})
+}
+
+func TestValidateRewritesConfig(t *testing.T) {
+	t.Run("clean configuration", func(t *testing.T) {
+		problems := validateRewritesConfig("rewrites.toml", []byte(`
+[rewrites]
+"/app/*" = "/index.html"
+"/docs/:page" = "/documentation/:page.html"
+`))
+		assert.Empty(t, problems)
+	})
+
+	t.Run("syntax errors", func(t *testing.T) {
+		problems := validateRewritesConfig("rewrites.toml", []byte("[rewrites\n"))
+		require.Len(t, problems, 1)
+		assert.Equal(t, severityError, problems[0].severity)
+	})
+
+	t.Run("every invalid rule is reported", func(t *testing.T) {
+		problems := validateRewritesConfig("rewrites.toml", []byte(`
+[rewrites]
+"/a" = "/"
+"/b" = "/../secret"
+"/c/*/d" = "/x"
+`))
+		errors := problemMessages(problems, severityError)
+		require.Len(t, errors, 3)
+		assert.Contains(t, errors[0], `invalid rewrite target "/" for path "/a"`)
+		assert.Contains(t, errors[1], `invalid rewrite target "/../secret" for path "/b"`)
+		assert.Contains(t, errors[2], "* must be the last segment")
+	})
+
+	t.Run("warnings", func(t *testing.T) {
+		problems := validateRewritesConfig("rewrites.toml", []byte(`
+[rewrite]
+"/x" = "/y"
+[rewrites]
+"/shop/:item" = "/shop.html"
+"/shop/:id" = "/item.html"
+"/old" = "/new.html"
+"old" = "/newer.html"
+`))
+		assert.ElementsMatch(t, []string{
+			`unknown key "rewrite"`,
+			`rewrite "/shop/:item" is shadowed by "/shop/:id" and never matches`,
+			`rewrites "/old" and "old" match the same path; only one of them is used`,
+		}, problemMessages(problems, severityWarning))
+		assert.Empty(t, problemMessages(problems, severityError))
+	})
+}
+
+func TestPatternCovers(t *testing.T) {
+	compile := func(path string) redirectPattern {
+		pattern, err := compileRedirectPattern(path, RedirectRule{To: "/x"})
+		require.NoError(t, err)
+		return pattern
+	}
+
+	assert.True(t, patternCovers(compile("blog/*"), compile("blog/:year/*")))
+	assert.True(t, patternCovers(compile("blog/*"), compile("blog/:year")))
+	assert.True(t, patternCovers(compile(":a/:b"), compile("x/:b")))
+	assert.True(t, patternCovers(compile("search?q="), compile("search?q=go")))
+	assert.False(t, patternCovers(compile("blog/:year/*"), compile("blog/*")))
+	assert.False(t, patternCovers(compile(":a/:b"), compile(":a")))
+	assert.False(t, patternCovers(compile("search?q=go"), compile("search?q=:term")))
+	assert.False(t, patternCovers(compile("search?q=:term"), compile("search?q=")))
+}
+
+func TestValidateHeadersConfig(t *testing.T) {
+	t.Run("clean configuration", func(t *testing.T) {
+		problems := validateHeadersConfig("headers.toml", []byte(`
+[cache]
+enabled = true
+[cache.rollout]
+enabled = true
+percentage = 50
+user_agent_rules = ["^Mozilla"]
+`))
+		assert.Empty(t, problems)
+	})
+
+	t.Run("warnings", func(t *testing.T) {
+		problems := validateHeadersConfig("headers.toml", []byte(`
+[cache.rollout]
+percentag = 50
+percentage = 150
+user_agent_rules = ["(unclosed"]
+[unknown_section]
+key = 1
+`))
+		warnings := problemMessages(problems, severityWarning)
+		require.Len(t, warnings, 4)
+		assert.Equal(t, `unknown key "cache.rollout.percentag"`, warnings[0])
+		assert.Equal(t, `unknown key "unknown_section"`, warnings[1])
+		assert.Contains(t, warnings[2], "cache.rollout.percentage 150 is out of range")
+		assert.Contains(t, warnings[3], `user_agent_rules "(unclosed" never matches`)
+		assert.Empty(t, problemMessages(problems, severityError))
+	})
+
+	t.Run("errors the server refuses", func(t *testing.T) {
+		problems := validateHeadersConfig("headers.toml", []byte("[clean_urls]\ntrailing_slash = \"sometimes\"\n"))
+		assert.Len(t, problemMessages(problems, severityError), 1)
+	})
+}
+
+func TestRunValidate(t *testing.T) {
+	site := t.TempDir()
+	writeTestFile(t, site, ".spray/redirects.toml", "[redirects]\n\"/old\" = \"/new\"\n")
+	writeTestFile(t, site, ".spray/headers.toml", "[powered_by]\nenabled = false\n")
+
+	run := func(opts validateOptions) (int, string) {
+		var out bytes.Buffer
+		code, err := runValidate(context.Background(), &out, opts)
+		require.NoError(t, err)
+		return code, out.String()
+	}
+
+	t.Run("site directory", func(t *testing.T) {
+		code, out := run(validateOptions{dir: site})
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "0 error(s), 0 warning(s)\n", out)
+	})
+
+	t.Run("content source", func(t *testing.T) {
+		code, _ := run(validateOptions{source: "file://" + site})
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("missing files are skipped", func(t *testing.T) {
+		code, _ := run(validateOptions{dir: t.TempDir()})
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("warnings only", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "headers.toml", "[powered_by]\nenabeld = false\n")
+		code, out := run(validateOptions{headers: filepath.Join(dir, "headers.toml")})
+		assert.Equal(t, validateExitWarnings, code)
+		assert.Contains(t, out, `headers.toml: warning: unknown key "powered_by.enabeld"`)
+		assert.Contains(t, out, "0 error(s), 1 warning(s)")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "redirects.toml", "[redirects]\n\"/a\" = \"nope\"\n\"/b\" = \"/b\"\n")
+		code, out := run(validateOptions{redirects: filepath.Join(dir, "redirects.toml")})
+		assert.Equal(t, validateExitErrors, code)
+		assert.Contains(t, out, "1 error(s), 0 warning(s)")
+	})
+
+	t.Run("rewrites", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, dir, ".spray/rewrites.toml", "[rewrites]\n\"/app/*\" = \"/\"\n")
+		code, out := run(validateOptions{dir: dir})
+		assert.Equal(t, validateExitErrors, code)
+		assert.Contains(t, out, `rewrites.toml: error: invalid rewrite target "/" for path "/app/*"`)
+
+		code, _ = run(validateOptions{rewrites: filepath.Join(dir, ".spray/rewrites.toml")})
+		assert.Equal(t, validateExitErrors, code)
+	})
+
+	t.Run("unreadable input", func(t *testing.T) {
+		_, err := runValidate(context.Background(), &bytes.Buffer{}, validateOptions{redirects: filepath.Join(t.TempDir(), "missing.toml")})
+		assert.Error(t, err)
+		_, err = runValidate(context.Background(), &bytes.Buffer{}, validateOptions{source: "ftp://bucket"})
+		assert.Error(t, err)
+	})
+}
+
+func TestValidateCommand_ExitCode(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, ".spray/headers.toml", "[powered_by]\nenabeld = false\n")
+
+	cmd := newValidateCommand()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{dir})
+	err := cmd.Execute()
+
+	var exitErr exitCodeError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, validateExitWarnings, exitErr.code)
+	assert.Contains(t, out.String(), "0 error(s), 1 warning(s)")
+
+	cmd = newValidateCommand()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetArgs([]string{t.TempDir()})
+	assert.NoError(t, cmd.Execute())
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/BurntSushi/toml"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// wildcardHost is the hosts file entry used for requests matching no other host
+const wildcardHost = "*"
+
+// HostsConfig represents the structure of the virtual hosts mapping file
+type HostsConfig struct {
+	Hosts map[string]HostMapping `toml:"hosts"`
+}
+
+// HostMapping maps a Host header to the content served for it
+type HostMapping struct {
+	Bucket string `toml:"bucket"` // GCS bucket name
+	Source string `toml:"source"` // any --source value, instead of bucket
+	Prefix string `toml:"prefix"` // optional path prefix inside the bucket
+}
+
+// virtualHost is a validated hosts file entry
+type virtualHost struct {
+	host       string
+	source     string
+	bucketName string // used for metrics and logging
+	prefix     string
+}
+
+// normalizeHost lowercases a host and strips any port so it can be matched against the hosts file
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// loadHostsConfig reads and validates the virtual hosts mapping file
+func loadHostsConfig(path string) ([]virtualHost, error) {
+	var hostsConfig HostsConfig
+	if _, err := toml.DecodeFile(path, &hostsConfig); err != nil {
+		return nil, fmt.Errorf("error parsing hosts file at %s: %v", path, err)
+	}
+	if len(hostsConfig.Hosts) == 0 {
+		return nil, fmt.Errorf("hosts file at %s defines no hosts", path)
+	}
+
+	hosts := make([]virtualHost, 0, len(hostsConfig.Hosts))
+	seen := make(map[string]string)
+	for name, mapping := range hostsConfig.Hosts {
+		host := name
+		if host != wildcardHost {
+			host = normalizeHost(name)
+		}
+		if host == "" {
+			return nil, fmt.Errorf("hosts file at %s contains an empty host name", path)
+		}
+		if previous, ok := seen[host]; ok {
+			return nil, fmt.Errorf("hosts %q and %q in %s refer to the same host", previous, name, path)
+		}
+		seen[host] = name
+
+		if (mapping.Bucket == "") == (mapping.Source == "") {
+			return nil, fmt.Errorf("host %q: exactly one of bucket or source is required", name)
+		}
+		source := mapping.Source
+		if mapping.Bucket != "" {
+			source = sourceSchemeGCS + "://" + mapping.Bucket
+		}
+		src, err := parseSource(source)
+		if err != nil {
+			return nil, fmt.Errorf("host %q: %v", name, err)
+		}
+
+		hosts = append(hosts, virtualHost{
+			host:       host,
+			source:     source,
+			bucketName: src.location,
+			prefix:     strings.Trim(mapping.Prefix, "/"),
+		})
+	}
+
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].host < hosts[j].host })
+	return hosts, nil
+}
+
+// prefixObjectStore serves objects from below a path prefix of another store
+type prefixObjectStore struct {
+	store  ObjectStore
+	prefix string
+}
+
+func (p *prefixObjectStore) key(path string) string {
+	return p.prefix + "/" + path
+}
+
+func (p *prefixObjectStore) GetObject(ctx context.Context, path string) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return p.store.GetObject(ctx, p.key(path))
+}
+
+func (p *prefixObjectStore) GetObjectRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, *storage.ObjectAttrs, error) {
+	return p.store.GetObjectRange(ctx, p.key(path), offset, length)
+}
+
+func (p *prefixObjectStore) GetObjectAttrs(ctx context.Context, path string) (*storage.ObjectAttrs, error) {
+	return p.store.GetObjectAttrs(ctx, p.key(path))
+}
+
+// ListObjects lists below the prefix and strips it from the returned names
+func (p *prefixObjectStore) ListObjects(ctx context.Context, prefix, pageToken string, limit int) ([]*storage.ObjectAttrs, string, error) {
+	entries, next, err := p.store.ListObjects(ctx, p.key(prefix), pageToken, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	stripped := make([]*storage.ObjectAttrs, len(entries))
+	for i, attrs := range entries {
+		attrs = copyObjectAttrs(attrs)
+		attrs.Name = strings.TrimPrefix(attrs.Name, p.prefix+"/")
+		attrs.Prefix = strings.TrimPrefix(attrs.Prefix, p.prefix+"/")
+		stripped[i] = attrs
+	}
+	return stripped, next, nil
+}
+
+// hostStores creates the stores for virtual hosts, sharing one GCS client and
+// one store per source between hosts
+type hostStores struct {
+	ctx       context.Context
+	gcsClient StorageClient
+	stores    map[string]ObjectStore
+	closers   []func() error
+}
+
+func newHostStores(ctx context.Context) *hostStores {
+	return &hostStores{ctx: ctx, stores: make(map[string]ObjectStore)}
+}
+
+// storeFor returns the store serving a virtual host, scoped to its prefix
+func (h *hostStores) storeFor(vh virtualHost) (ObjectStore, error) {
+	store, ok := h.stores[vh.source]
+	if !ok {
+		src, err := parseSource(vh.source)
+		if err != nil {
+			return nil, err
+		}
+
+		if src.scheme == sourceSchemeGCS {
+			if h.gcsClient == nil {
+				client, err := storageClientFactory(h.ctx)
+				if err != nil {
+					return nil, fmt.Errorf("failed to create storage client: %v", err)
+				}
+				h.gcsClient = client
+				h.closers = append(h.closers, client.Close)
+			}
+			store = newGCSObjectStore(h.gcsClient, src.location)
+		} else {
+			var closeStore func() error
+			store, closeStore, err = createObjectStore(h.ctx, &config{source: vh.source, bucketName: src.location})
+			if err != nil {
+				return nil, err
+			}
+			h.closers = append(h.closers, closeStore)
+		}
+		h.stores[vh.source] = store
+	}
+
+	if vh.prefix != "" {
+		return &prefixObjectStore{store: store, prefix: vh.prefix}, nil
+	}
+	return store, nil
+}
+
+// Close releases every client created for the virtual hosts
+func (h *hostStores) Close() error {
+	var firstErr error
+	for _, closeFn := range h.closers {
+		if err := closeFn(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// hostRouter dispatches requests to the gcsServer configured for their Host header
+type hostRouter struct {
+	servers  map[string]*gcsServer
+	fallback *gcsServer // serves hosts without an entry of their own, may be nil
+}
+
+// resolve returns the server for a Host header, or nil when none is configured
+func (h *hostRouter) resolve(host string) *gcsServer {
+	if server, ok := h.servers[normalizeHost(host)]; ok {
+		return server
+	}
+	return h.fallback
+}
+
+func (h *hostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server := h.resolve(r.Host)
+	if server == nil {
+		unknownHostRequests.Inc()
+		http.Error(w, "Unknown host", http.StatusNotFound)
+		return
+	}
+	server.ServeHTTP(w, r)
+}
+
+// forHost serves a configuration endpoint with the server of the requested host
+func (h *hostRouter) forHost(handler func(*gcsServer) http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server := h.resolve(r.Host)
+		if server == nil {
+			unknownHostRequests.Inc()
+			http.Error(w, "Unknown host", http.StatusNotFound)
+			return
+		}
+		handler(server)(w, r)
+	}
+}
+
+// createVirtualHostServer creates an HTTP server that serves every site in the hosts
+// file from one process. Each host has its own store, redirects, rewrites and headers loaded
+// from its own .spray/ directory. The returned function closes the storage clients.
+func createVirtualHostServer(ctx context.Context, cfg *config, logClient LoggingClient) (*http.Server, func() error, error) {
+	hosts, err := loadHostsConfig(cfg.hostsFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stores := newHostStores(ctx)
+	router := &hostRouter{servers: make(map[string]*gcsServer)}
+	reloader := &siteReloader{}
+	logger := logClient.Logger("gcs-server")
+	mux := http.NewServeMux()
+	srv := &http.Server{
+		Addr:    ":" + cfg.port,
+		Handler: mux,
+	}
+	// Reloads stop when the server shuts down, or right away when a host fails to load
+	reloadCtx, stopReloads := context.WithCancel(ctx)
+	srv.RegisterOnShutdown(stopReloads)
+	abort := func() {
+		stopReloads()
+		stores.Close()
+	}
+
+	for _, vh := range hosts {
+		store, err := stores.storeFor(vh)
+		if err != nil {
+			abort()
+			return nil, nil, fmt.Errorf("host %q: %v", vh.host, err)
+		}
+
+		redirects, redirectWarnings, err := loadRedirects(ctx, store)
+		if err != nil {
+			abort()
+			return nil, nil, fmt.Errorf("host %q: error loading redirects: %v", vh.host, err)
+		}
+		rewrites, err := loadRewrites(ctx, store)
+		if err != nil {
+			abort()
+			return nil, nil, fmt.Errorf("host %q: error loading rewrites: %v", vh.host, err)
+		}
+		headers, headerWarnings, err := loadHeaders(ctx, store)
+		if err != nil {
+			abort()
+			return nil, nil, fmt.Errorf("host %q: error loading headers: %v", vh.host, err)
+		}
+
+		siteCfg := &config{
+			bucketName:  vh.bucketName,
+			source:      vh.source,
+			store:       store,
+			objectCache: cfg.objectCache,
+			redirects:   redirects,
+			rewrites:    rewrites,
+			headers:     headers,
+		}
+		server, err := newGCSServer(ctx, vh.bucketName, logger, servingStore(siteCfg), redirects, rewrites, headers)
+		if err != nil {
+			abort()
+			return nil, nil, fmt.Errorf("host %q: %v", vh.host, err)
+		}
+		server.site.warnings = append(redirectWarnings, headerWarnings...)
+		server.startConfigReload(reloadCtx, store, cfg.objectCache, cfg.reloadInterval)
+		reloader.targets = append(reloader.targets, reloadTarget{host: vh.host, server: server})
+
+		if vh.host == wildcardHost {
+			router.fallback = server
+		} else {
+			router.servers[vh.host] = server
+		}
+	}
+
+	mux.Handle("/", router)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/readyz", readyzHandler)
+	mux.HandleFunc("/livez", livezHandler)
+	serveConfigEndpoints(mux, cfg.configEndpoints, cfg.adminToken, map[string]http.HandlerFunc{
+		"/config":           router.forHost(configHandler),
+		"/config/redirects": router.forHost(configRedirectsHandler),
+		"/config/headers":   router.forHost(configHeadersHandler),
+	})
+	serveReloads(reloadCtx, mux, reloader, cfg.adminToken)
+
+	return srv, stores.Close, nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeHostsFile writes a virtual hosts mapping file and returns its path
+func writeHostsFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hosts.toml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestNormalizeHost(t *testing.T) {
+	assert.Equal(t, "example.com", normalizeHost("Example.COM"))
+	assert.Equal(t, "example.com", normalizeHost("example.com:8080"))
+	assert.Equal(t, "example.com", normalizeHost("example.com."))
+	assert.Equal(t, "::1", normalizeHost("[::1]:8080"))
+}
+
+func TestLoadHostsConfig(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		path := writeHostsFile(t, `
+[hosts."www.example.com"]
+bucket = "example-site"
+
+[hosts."Docs.Example.com"]
+bucket = "shared-bucket"
+prefix = "/docs/"
+
+[hosts."local.test"]
+source = "file:///srv/site"
+
+[hosts."*"]
+bucket = "fallback-site"
+`)
+		hosts, err := loadHostsConfig(path)
+		require.NoError(t, err)
+		assert.Equal(t, []virtualHost{
+			{host: "*", source: "gs://fallback-site", bucketName: "fallback-site"},
+			{host: "docs.example.com", source: "gs://shared-bucket", bucketName: "shared-bucket", prefix: "docs"},
+			{host: "local.test", source: "file:///srv/site", bucketName: "/srv/site"},
+			{host: "www.example.com", source: "gs://example-site", bucketName: "example-site"},
+		}, hosts)
+	})
+
+	errorCases := map[string]string{
+		"empty":             "",
+		"no target":         "[hosts.\"a.com\"]\nprefix = \"x\"\n",
+		"bucket and source": "[hosts.\"a.com\"]\nbucket = \"b\"\nsource = \"gs://b\"\n",
+		"invalid source":    "[hosts.\"a.com\"]\nsource = \"ftp://b\"\n",
+		"duplicate host":    "[hosts.\"a.com\"]\nbucket = \"b\"\n[hosts.\"A.com\"]\nbucket = \"c\"\n",
+		"invalid toml":      "[hosts\n",
+	}
+	for name, content := range errorCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadHostsConfig(writeHostsFile(t, content))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := loadHostsConfig(filepath.Join(t.TempDir(), "missing.toml"))
+	assert.Error(t, err)
+}
+
+func TestPrefixObjectStore(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, "sites/blog/index.html", "blog")
+
+	backing, err := newFileObjectStore(root)
+	require.NoError(t, err)
+	store := &prefixObjectStore{store: backing, prefix: "sites/blog"}
+
+	reader, _, err := store.GetObject(context.Background(), "index.html")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, "blog", string(data))
+
+	attrs, err := store.GetObjectAttrs(context.Background(), "index.html")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), attrs.Size)
+
+	reader, _, err = store.GetObjectRange(context.Background(), "index.html", 1, 2)
+	require.NoError(t, err)
+	data, _ = io.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, "lo", string(data))
+
+	entries, _, err := store.ListObjects(context.Background(), "", "", 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "index.html", entries[0].Name)
+}
+
+func TestCreateVirtualHostServer(t *testing.T) {
+	siteA := t.TempDir()
+	writeTestFile(t, siteA, "index.html", "site A")
+	writeTestFile(t, siteA, ".spray/redirects.toml", "[redirects]\n\"/old\" = \"https://a.example.com/new\"\n")
+
+	shared := t.TempDir()
+	writeTestFile(t, shared, "blog/index.html", "blog")
+	writeTestFile(t, shared, "blog/.spray/headers.toml", "[powered_by]\nenabled = false\n")
+	writeTestFile(t, shared, "docs/index.html", "docs")
+
+	hostsFile := writeHostsFile(t, `
+[hosts."a.example.com"]
+source = "file://`+siteA+`"
+
+[hosts."blog.example.com"]
+source = "file://`+shared+`"
+prefix = "blog"
+
+[hosts."docs.example.com"]
+source = "file://`+shared+`"
+prefix = "docs"
+`)
+
+	srv, closeStores, err := createVirtualHostServer(t.Context(), &config{port: "8080", hostsFile: hostsFile}, newMockLogClient())
+	require.NoError(t, err)
+	defer closeStores()
+	assert.Equal(t, ":8080", srv.Addr)
+
+	serve := func(host, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = host
+		rr := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("routes by host", func(t *testing.T) {
+		assert.Equal(t, "site A", serve("a.example.com", "/").Body.String())
+		assert.Equal(t, "site A", serve("A.Example.com:443", "/").Body.String())
+		assert.Equal(t, "blog", serve("blog.example.com", "/").Body.String())
+		assert.Equal(t, "docs", serve("docs.example.com", "/").Body.String())
+	})
+
+	t.Run("per-host configuration", func(t *testing.T) {
+		rr := serve("a.example.com", "/old")
+		assert.Equal(t, http.StatusFound, rr.Code)
+		assert.Equal(t, "https://a.example.com/new", rr.Header().Get("Location"))
+		assert.Equal(t, http.StatusNotFound, serve("blog.example.com", "/old").Code)
+
+		assert.NotEmpty(t, serve("a.example.com", "/").Header().Get("X-Powered-By"))
+		assert.Empty(t, serve("blog.example.com", "/").Header().Get("X-Powered-By"))
+	})
+
+	t.Run("prefix confines the host", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve("blog.example.com", "/docs/index.html").Code)
+	})
+
+	t.Run("config endpoint per host", func(t *testing.T) {
+		rr := serve("a.example.com", "/config/redirects")
+		require.Equal(t, http.StatusOK, rr.Code)
+		var body struct {
+			Redirects  map[string]string `json:"redirects"`
+			BucketName string            `json:"bucket_name"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+		assert.Equal(t, siteA, body.BucketName)
+		assert.Equal(t, map[string]string{"old": "https://a.example.com/new"}, body.Redirects)
+	})
+
+	t.Run("headers endpoint per host", func(t *testing.T) {
+		rr := serve("blog.example.com", "/config/headers")
+		require.Equal(t, http.StatusOK, rr.Code)
+		var body struct {
+			Headers HeaderConfig `json:"headers"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&body))
+		assert.False(t, body.Headers.PoweredBy.Enabled)
+		assert.Contains(t, serve("a.example.com", "/config/headers").Body.String(), `"powered_by":{"enabled":true}`)
+	})
+
+	t.Run("metrics are labelled by resolved bucket", func(t *testing.T) {
+		before := testutil.ToFloat64(requestsTotal.WithLabelValues(shared, "index.html", "GET", "200"))
+		serve("docs.example.com", "/")
+		assert.Equal(t, before+1, testutil.ToFloat64(requestsTotal.WithLabelValues(shared, "index.html", "GET", "200")))
+	})
+
+	t.Run("unknown host", func(t *testing.T) {
+		before := testutil.ToFloat64(unknownHostRequests)
+		assert.Equal(t, http.StatusNotFound, serve("other.example.com", "/").Code)
+		assert.Equal(t, before+1, testutil.ToFloat64(unknownHostRequests))
+	})
+
+	t.Run("health endpoints", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("anything", "/readyz").Code)
+	})
+}
+
+func TestCreateVirtualHostServer_Fallback(t *testing.T) {
+	site := t.TempDir()
+	writeTestFile(t, site, "index.html", "default site")
+	hostsFile := writeHostsFile(t, "[hosts.\"*\"]\nsource = \"file://"+site+"\"\n")
+
+	srv, closeStores, err := createVirtualHostServer(t.Context(), &config{port: "8080", hostsFile: hostsFile}, newMockLogClient())
+	require.NoError(t, err)
+	defer closeStores()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "unlisted.example.com"
+	rr := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(rr, req)
+	assert.Equal(t, "default site", rr.Body.String())
+}
+
+func TestCreateVirtualHostServer_Errors(t *testing.T) {
+	_, _, err := createVirtualHostServer(t.Context(), &config{hostsFile: filepath.Join(t.TempDir(), "missing.toml")}, newMockLogClient())
+	assert.Error(t, err)
+
+	hostsFile := writeHostsFile(t, "[hosts.\"a.com\"]\nsource = \"file://"+filepath.Join(t.TempDir(), "missing")+"\"\n")
+	_, _, err = createVirtualHostServer(t.Context(), &config{hostsFile: hostsFile}, newMockLogClient())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `host "a.com"`)
+}
+
+func TestHostStores_SharesGCSClient(t *testing.T) {
+	originalFactory := storageClientFactory
+	defer func() { storageClientFactory = originalFactory }()
+
+	clients := 0
+	storageClientFactory = func(ctx context.Context) (StorageClient, error) {
+		clients++
+		return &mockStorageClient{objects: map[string]mockObject{}}, nil
+	}
+
+	stores := newHostStores(context.Background())
+	_, err := stores.storeFor(virtualHost{host: "a.com", source: "gs://one", bucketName: "one"})
+	require.NoError(t, err)
+	_, err = stores.storeFor(virtualHost{host: "b.com", source: "gs://two", bucketName: "two"})
+	require.NoError(t, err)
+	prefixed, err := stores.storeFor(virtualHost{host: "c.com", source: "gs://two", bucketName: "two", prefix: "c"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, clients)
+	assert.Len(t, stores.stores, 2)
+	assert.IsType(t, &prefixObjectStore{}, prefixed)
+	assert.NoError(t, stores.Close())
+}
+
+func TestLoadConfig_HostsFile(t *testing.T) {
+	t.Setenv("BUCKET_NAME", "")
+	t.Setenv("GOOGLE_PROJECT_ID", "")
+	t.Setenv("SPRAY_SOURCE", "")
+	t.Setenv("SPRAY_HOSTS_FILE", "/etc/spray/hosts.toml")
+
+	cfg, err := loadConfig(context.Background(), &config{port: "8080"}, nil)
+	require.NoError(t, err, "virtual hosting does not need BUCKET_NAME")
+	assert.Equal(t, "/etc/spray/hosts.toml", cfg.hostsFile)
+}